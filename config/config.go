@@ -3,10 +3,14 @@ package config
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	log "github.com/vyneer/lwodcollector/logger"
@@ -20,6 +24,9 @@ import (
 type LWODDBConfig struct {
 	DB         *sql.DB
 	Statements LWODStatements
+	// whether the lwod_fts table is there, SQLite has to be built with the
+	// sqlite_fts5 tag for it
+	FTS bool
 }
 
 type YTDBConfig struct {
@@ -29,26 +36,33 @@ type YTDBConfig struct {
 
 type LWODStatements struct {
 	SelectYTHashStmt       *sql.Stmt
-	SelectYTByHashStmt     *sql.Stmt
-	DeleteYTStmt           *sql.Stmt
 	SelectTwitchHashStmt   *sql.Stmt
-	SelectTwitchByHashStmt *sql.Stmt
-	DeleteTwitchStmt       *sql.Stmt
 	SelectRumbleHashStmt   *sql.Stmt
-	SelectRumbleByHashStmt *sql.Stmt
-	DeleteRumbleStmt       *sql.Stmt
 	SelectKickHashStmt     *sql.Stmt
-	SelectKickByHashStmt   *sql.Stmt
-	DeleteKickStmt         *sql.Stmt
 	SelectOdyseeHashStmt   *sql.Stmt
-	SelectOdyseeByHashStmt *sql.Stmt
-	DeleteOdyseeStmt       *sql.Stmt
-	InsertYTStmt           *sql.Stmt
-	InsertTwitchStmt       *sql.Stmt
-	InsertRumbleStmt       *sql.Stmt
-	InsertKickStmt         *sql.Stmt
-	InsertOdyseeStmt       *sql.Stmt
+	UpsertYTStmt           *sql.Stmt
+	UpsertTwitchStmt       *sql.Stmt
+	UpsertRumbleStmt       *sql.Stmt
+	UpsertKickStmt         *sql.Stmt
+	UpsertOdyseeStmt       *sql.Stmt
 	InsertURLStmt          *sql.Stmt
+	InsertParseErrorStmt   *sql.Stmt
+	SelectStateStmt        *sql.Stmt
+	UpsertStateStmt        *sql.Stmt
+	SelectSheetVersionStmt *sql.Stmt
+	UpsertSheetStmt        *sql.Stmt
+	InsertHistoryStmt      *sql.Stmt
+}
+
+// SnapshotDBConfig is the index of the spreadsheet snapshot store, kept in
+// the store itself so it can be used without the LWOD DB.
+type SnapshotDBConfig struct {
+	DB         *sql.DB
+	Statements SnapshotStatements
+}
+
+type SnapshotStatements struct {
+	InsertSnapshotStmt *sql.Stmt
 }
 
 type YTStatements struct {
@@ -64,12 +78,28 @@ type GoogleConfig struct {
 	Drive   *drive.Service
 	Sheets  *sheets.Service
 	YouTube *youtube.Service
+	// HTTP is the authorized client the services use
+	HTTP *http.Client
 }
 
 type Flags struct {
 	Verbose   bool
 	AllSheets bool
 	AllVideos bool
+	Lenient   bool
+	DryRun    bool
+	Force     bool
+	// From and To are the first and the last month to process (YYYY-MM)
+	From, To string
+	// Sheet is the ID of the only spreadsheet to process
+	Sheet string
+	// Limit is how many search results to print
+	Limit int
+	// VOD is the ID of the VOD to print the history of
+	VOD string
+	// Snapshots is the snapshot store to replay, DB the LWOD DB to replay
+	// it into
+	Snapshots, DB string
 }
 
 type Config struct {
@@ -81,6 +111,7 @@ type Config struct {
 	YTPlaylist      string
 	LWODHealthCheck string
 	YTHealthCheck   string
+	LWODLenient     bool
 	LWODDelay       int
 	LWODRefresh     int
 	YTDelay         int
@@ -91,9 +122,48 @@ type Config struct {
 	LWODDBConfig    LWODDBConfig
 	YTDBConfig      YTDBConfig
 	GoogleConfig    GoogleConfig
+
+	// extra header aliases per LWOD template field, see LWOD_HEADER_ALIASES
+	LWODHeaderAliases map[string][]string
+	LWODLayout        LWODLayout
+	// canonical game names and their aliases, see LWOD_GAMES
+	LWODGames map[string][]string
+	// canonical subject names and their aliases, see LWOD_SUBJECTS
+	LWODSubjects map[string][]string
+
+	// how many spreadsheets get fetched at the same time
+	LWODWorkers int
+	// requests per second to the Drive and the Sheets APIs, 0 for no limit
+	LWODDriveRPS  float64
+	LWODSheetsRPS float64
+	// how many hours can go by without scanning the sheets when only the
+	// Drive changes are checked, 0 for no limit
+	LWODFullScanHours int
+
+	// where the fetched spreadsheets get archived, see LWOD_SNAPSHOT_DIR
+	LWODSnapshotDir string
+	// how many days the snapshots are kept for, 0 for forever
+	LWODSnapshotRetention int
+	// how many of the latest snapshots of every spreadsheet are always kept
+	LWODSnapshotKeep int
+	SnapshotDBConfig SnapshotDBConfig
+}
+
+// LWODLayout describes how the LWOD spreadsheets are laid out in LWOD_FOLDER.
+// The patterns are regular expressions with optional named "year" and
+// "month" captures, together they have to give the year and the month of
+// every spreadsheet.
+type LWODLayout struct {
+	// Folders has a pattern for every level of folders between LWOD_FOLDER
+	// and the spreadsheets, nil for the default layout
+	Folders []string `json:"folders"`
+	// Sheets are tried in order on the names of the spreadsheets, nil for the
+	// default ones
+	Sheets []string `json:"sheets"`
 }
 
 const sqlCreateMain string = `CREATE TABLE IF NOT EXISTS lwod (
+	id integer primary key autoincrement,
 	dateadded text,
 	datestreamed text,
 	vodid text, 
@@ -111,6 +181,16 @@ const sqlCreateMain string = `CREATE TABLE IF NOT EXISTS lwod (
 	game text, 
 	subject text, 
 	topic text,
+	startseconds integer,
+	endseconds integer,
+	duration integer,
+	timeflag text,
+	gameid integer REFERENCES games(id),
+	sheetid text,
+	worksheetid integer,
+	sheetrow integer,
+	cellurl text,
+	removed_at text,
 	FOREIGN KEY (vodid)
 		REFERENCES twitch(id)
 		ON DELETE CASCADE,
@@ -128,33 +208,197 @@ const sqlCreateMain string = `CREATE TABLE IF NOT EXISTS lwod (
 		ON DELETE CASCADE
 );`
 
+// columns added to the lwod table after it was first created, ALTERed into
+// older tables
+var sqlMainColumns = []struct {
+	name, definition string
+}{
+	{"startseconds", "integer"},
+	{"endseconds", "integer"},
+	{"duration", "integer"},
+	{"timeflag", "text"},
+	{"gameid", "integer REFERENCES games(id)"},
+	{"sheetid", "text"},
+	{"worksheetid", "integer"},
+	{"sheetrow", "integer"},
+	{"cellurl", "text"},
+	{"removed_at", "text"},
+}
+
+// columns added to the platform tables after they were first created
+var sqlPlatformColumns = []struct {
+	name, definition string
+}{
+	{"removed_at", "text"},
+}
+
+var lwodPlatformTables = []string{"youtube", "twitch", "rumble", "kick", "odysee"}
+
+// lwodTables is every table migrateLWODDatabase creates, apart from lwod_fts
+// which depends on the build
+var lwodTables = append([]string{"games", "game_aliases", "lwod", "lwod_notes", "subjects", "subject_aliases", "lwod_subjects", "lwod_history", "lwodUrl", "parse_errors", "lwod_state", "sheets"}, lwodPlatformTables...)
+
+// lwod tables created before the id column existed are rebuilt with it, the
+// existing rows keeping their rowids as ids
+const sqlMigrateMainID string = `ALTER TABLE lwod RENAME TO lwod_old;
+` + sqlCreateMain + `
+INSERT INTO lwod (id, dateadded, datestreamed, vodid, vidid, rumbleid, kickid, odyseeid, starttime, endtime, yttime, twitchtime, rumbletime, kicktime, odyseetime, game, subject, topic)
+	SELECT rowid, dateadded, datestreamed, vodid, vidid, rumbleid, kickid, odyseeid, starttime, endtime, yttime, twitchtime, rumbletime, kicktime, odyseetime, game, subject, topic FROM lwod_old;
+DROP TABLE lwod_old;`
+
+const sqlCreateNotes string = `CREATE TABLE IF NOT EXISTS lwod_notes (
+	lwodid integer,
+	field text,
+	note text,
+	FOREIGN KEY (lwodid)
+		REFERENCES lwod(id)
+		ON DELETE CASCADE
+);`
+
+const sqlCreateGames string = `CREATE TABLE IF NOT EXISTS games (
+	id integer primary key autoincrement,
+	name text unique
+);`
+
+// game_aliases mirrors LWOD_GAMES, the aliases being normalized (lowercase,
+// single spaces) and including the canonical names themselves
+const sqlCreateGameAliases string = `CREATE TABLE IF NOT EXISTS game_aliases (
+	alias text primary key,
+	gameid integer,
+	FOREIGN KEY (gameid)
+		REFERENCES games(id)
+		ON DELETE CASCADE
+);`
+
+const sqlCreateSubjects string = `CREATE TABLE IF NOT EXISTS subjects (
+	id integer primary key autoincrement,
+	name text unique
+);`
+
+// subject_aliases mirrors LWOD_SUBJECTS like game_aliases does LWOD_GAMES,
+// subjects that aren't in it get added to subjects as they are
+const sqlCreateSubjectAliases string = `CREATE TABLE IF NOT EXISTS subject_aliases (
+	alias text primary key,
+	subjectid integer,
+	FOREIGN KEY (subjectid)
+		REFERENCES subjects(id)
+		ON DELETE CASCADE
+);`
+
+const sqlCreateLWODSubjects string = `CREATE TABLE IF NOT EXISTS lwod_subjects (
+	lwodid integer,
+	subjectid integer,
+	PRIMARY KEY (lwodid, subjectid),
+	FOREIGN KEY (lwodid)
+		REFERENCES lwod(id)
+		ON DELETE CASCADE,
+	FOREIGN KEY (subjectid)
+		REFERENCES subjects(id)
+		ON DELETE CASCADE
+);`
+
+const sqlCreateParseErrors string = `CREATE TABLE IF NOT EXISTS parse_errors (
+	time text,
+	sheetid text,
+	worksheet text,
+	row integer,
+	col text,
+	value text,
+	error text
+);`
+
+// lwod_state keeps small bits of state between runs, like the Drive changes
+// page token
+const sqlCreateState string = `CREATE TABLE IF NOT EXISTS lwod_state (
+	key text primary key,
+	value text
+);`
+
+const sqlCreateSheets string = `CREATE TABLE IF NOT EXISTS sheets (
+	id text primary key,
+	name text,
+	folder text,
+	modifiedtime text,
+	version integer,
+	lastparsed text
+);`
+
+// lwod_fts indexes the topic, subject and game of the lwod rows, the
+// triggers keeping it in sync with the lwod table
+const sqlCreateFTS string = `CREATE VIRTUAL TABLE IF NOT EXISTS lwod_fts USING fts5(
+	topic,
+	subject,
+	game,
+	content='lwod',
+	content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS lwod_fts_insert AFTER INSERT ON lwod BEGIN
+	INSERT INTO lwod_fts (rowid, topic, subject, game) VALUES (new.id, new.topic, new.subject, new.game);
+END;
+CREATE TRIGGER IF NOT EXISTS lwod_fts_delete AFTER DELETE ON lwod BEGIN
+	INSERT INTO lwod_fts (lwod_fts, rowid, topic, subject, game) VALUES ('delete', old.id, old.topic, old.subject, old.game);
+END;
+CREATE TRIGGER IF NOT EXISTS lwod_fts_update AFTER UPDATE OF topic, subject, game ON lwod BEGIN
+	INSERT INTO lwod_fts (lwod_fts, rowid, topic, subject, game) VALUES ('delete', old.id, old.topic, old.subject, old.game);
+	INSERT INTO lwod_fts (rowid, topic, subject, game) VALUES (new.id, new.topic, new.subject, new.game);
+END;`
+
+// without FTS5 the triggers would break every write to the lwod table
+const sqlDropFTSTriggers string = `DROP TRIGGER IF EXISTS lwod_fts_insert;
+DROP TRIGGER IF EXISTS lwod_fts_delete;
+DROP TRIGGER IF EXISTS lwod_fts_update;`
+
+// lwod_history is append-only, every insert, update and removal of an lwod
+// row adds a row with the old and the new values as JSON
+const sqlCreateHistory string = `CREATE TABLE IF NOT EXISTS lwod_history (
+	id integer primary key autoincrement,
+	runid text,
+	time text,
+	lwodid integer,
+	action text,
+	old text,
+	new text
+);
+CREATE INDEX IF NOT EXISTS lwod_history_lwodid ON lwod_history(lwodid);
+CREATE TRIGGER IF NOT EXISTS lwod_history_no_update BEFORE UPDATE ON lwod_history BEGIN
+	SELECT RAISE(ABORT, 'lwod_history is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS lwod_history_no_delete BEFORE DELETE ON lwod_history BEGIN
+	SELECT RAISE(ABORT, 'lwod_history is append-only');
+END;`
+
 const sqlCreateTwitch string = `CREATE TABLE IF NOT EXISTS twitch (
 	id text, 
 	hash text,
+	removed_at text,
 	PRIMARY KEY (id)
 );`
 
 const sqlCreateYouTube string = `CREATE TABLE IF NOT EXISTS youtube (
 	id text, 
 	hash text,
+	removed_at text,
 	PRIMARY KEY (id)
 );`
 
 const sqlCreateRumble string = `CREATE TABLE IF NOT EXISTS rumble (
 	id text, 
 	hash text,
+	removed_at text,
 	PRIMARY KEY (id)
 );`
 
 const sqlCreateKick string = `CREATE TABLE IF NOT EXISTS kick (
 	id text, 
 	hash text,
+	removed_at text,
 	PRIMARY KEY (id)
 );`
 
 const sqlCreateOdysee string = `CREATE TABLE IF NOT EXISTS odysee (
 	id text, 
 	hash text,
+	removed_at text,
 	PRIMARY KEY (id)
 );`
 
@@ -175,18 +419,255 @@ const sqlCreateLEtagIndex string = `CREATE UNIQUE INDEX IF NOT EXISTS letags ON
 
 const sqlCreatePEtagIndex string = `CREATE UNIQUE INDEX IF NOT EXISTS petags ON playlistEtag(etag);`
 
-func LoadDotEnv() Config {
+const sqlCreateSnapshots string = `CREATE TABLE IF NOT EXISTS snapshots (
+	id integer primary key autoincrement,
+	runid text,
+	fetched text,
+	sheetid text,
+	name text,
+	folder text,
+	sheetkey text,
+	modifiedtime text,
+	version integer,
+	hash text,
+	size integer
+);
+CREATE INDEX IF NOT EXISTS snapshots_sheetid ON snapshots(sheetid, fetched);
+CREATE INDEX IF NOT EXISTS snapshots_hash ON snapshots(hash);`
+
+func hasColumn(db *sql.DB, table string, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// lwodMigrated reports whether the LWOD DB has all the tables and columns
+// migrateLWODDatabase would add, for the dry runs that can't migrate it.
+func lwodMigrated(db *sql.DB) (bool, error) {
+	for _, table := range lwodTables {
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n); err != nil {
+			return false, err
+		}
+		if n == 0 {
+			return false, nil
+		}
+	}
+
+	columns := map[string][]string{"lwod": {"id"}}
+	for _, column := range sqlMainColumns {
+		columns["lwod"] = append(columns["lwod"], column.name)
+	}
+	for _, table := range lwodPlatformTables {
+		for _, column := range sqlPlatformColumns {
+			columns[table] = append(columns[table], column.name)
+		}
+	}
+	for table, names := range columns {
+		for _, name := range names {
+			ok, err := hasColumn(db, table, name)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// addColumns adds the columns the table doesn't have yet.
+func addColumns(db *sql.DB, table string, columns []struct{ name, definition string }) error {
+	for _, column := range columns {
+		ok, err := hasColumn(db, table, column.name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		log.Infof("Adding the %s column to the %s table", column.name, table)
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column.name, column.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrate(db *sql.DB, query string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// createFTS creates lwod_fts and its triggers, filling lwod_fts in if the
+// triggers weren't there (a new DB, or one last opened by a build without
+// FTS5). Returns false if SQLite was built without FTS5.
+func createFTS(db *sql.DB) (bool, error) {
+	var fts5 bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return false, err
+	}
+	if !fts5 {
+		_, err := db.Exec(sqlDropFTSTriggers)
+		return false, err
+	}
+
+	var triggers int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'lwod_fts_insert'").Scan(&triggers); err != nil {
+		return false, err
+	}
+	if err := migrate(db, sqlCreateFTS); err != nil {
+		return false, err
+	}
+	if triggers == 0 {
+		log.Infof("Building the lwod_fts search index")
+		if _, err := db.Exec("INSERT INTO lwod_fts (lwod_fts) VALUES ('rebuild')"); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// loadJSON reads a JSON object into v, the object either given inline or as
+// a path to a file.
+func loadJSON(value string, v any) error {
+	b := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var err error
+		b, err = os.ReadFile(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// loadAliases reads a JSON object of string arrays, either given inline or
+// as a path to a file.
+func loadAliases(value string) (map[string][]string, error) {
+	var aliases map[string][]string
+	if err := loadJSON(value, &aliases); err != nil {
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+// loadLayout reads the LWOD folder layout and makes sure its patterns compile
+// and only capture a year and a month.
+func loadLayout(value string) (LWODLayout, error) {
+	var layout LWODLayout
+	if err := loadJSON(value, &layout); err != nil {
+		return layout, err
+	}
+
+	for _, pattern := range append(append([]string(nil), layout.Folders...), layout.Sheets...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return layout, err
+		}
+		for _, name := range re.SubexpNames() {
+			if name != "" && name != "year" && name != "month" {
+				return layout, fmt.Errorf(`unknown capture "%s" in "%s", only "year" and "month" are supported`, name, pattern)
+			}
+		}
+	}
+
+	return layout, nil
+}
+
+// LoadLWODDotEnv loads only the settings of the LWOD parser and its DB, for
+// the modes that never talk to Google (LWOD_DB_FILE is checked by the ones
+// that use it, replays go to a DB of their own).
+func LoadLWODDotEnv() Config {
 	var err error
 	var cfg Config
 
 	log.Debugf("Loading environment variables")
 	godotenv.Load()
 
+	cfg.LWODDBFile = os.Getenv("LWOD_DB_FILE")
+	lwodLenientStr := os.Getenv("LWOD_LENIENT")
+	if lwodLenientStr != "" {
+		cfg.LWODLenient, err = strconv.ParseBool(lwodLenientStr)
+		if err != nil {
+			log.Fatalf("strconv error: %s", err)
+		}
+	}
+	headerAliases := os.Getenv("LWOD_HEADER_ALIASES")
+	if headerAliases != "" {
+		cfg.LWODHeaderAliases, err = loadAliases(headerAliases)
+		if err != nil {
+			log.Fatalf("Error loading the LWOD header aliases: %s", err)
+		}
+	}
+	games := os.Getenv("LWOD_GAMES")
+	if games != "" {
+		cfg.LWODGames, err = loadAliases(games)
+		if err != nil {
+			log.Fatalf("Error loading the LWOD games: %s", err)
+		}
+	}
+	subjects := os.Getenv("LWOD_SUBJECTS")
+	if subjects != "" {
+		cfg.LWODSubjects, err = loadAliases(subjects)
+		if err != nil {
+			log.Fatalf("Error loading the LWOD subjects: %s", err)
+		}
+	}
+	layout := os.Getenv("LWOD_LAYOUT")
+	if layout != "" {
+		cfg.LWODLayout, err = loadLayout(layout)
+		if err != nil {
+			log.Fatalf("Error loading the LWOD folder layout: %s", err)
+		}
+	}
+	lwodWorkersStr := os.Getenv("LWOD_WORKERS")
+	if lwodWorkersStr == "" {
+		lwodWorkersStr = "4"
+	}
+	cfg.LWODWorkers, err = strconv.Atoi(lwodWorkersStr)
+	if err != nil {
+		log.Fatalf("strconv error: %s", err)
+	}
+	if cfg.LWODWorkers < 1 {
+		log.Fatalf("LWOD_WORKERS has to be at least 1")
+	}
+
+	log.Debugf("LWOD environment variables loaded successfully")
+	return cfg
+}
+
+func LoadDotEnv() Config {
+	var err error
+	cfg := LoadLWODDotEnv()
+
 	cfg.GoogleCred = os.Getenv("GOOGLE_CRED")
 	if cfg.GoogleCred == "" {
 		log.Fatalf("Please set the GOOGLE_CRED environment variable and restart the app")
 	}
-	cfg.LWODDBFile = os.Getenv("LWOD_DB_FILE")
 	if cfg.LWODDBFile == "" {
 		log.Fatalf("Please set the LWOD_DB_FILE environment variable and restart the app")
 	}
@@ -224,6 +705,53 @@ func LoadDotEnv() Config {
 	if err != nil {
 		log.Fatalf("strconv error: %s", err)
 	}
+	lwodDriveRPSStr := os.Getenv("LWOD_DRIVE_RPS")
+	if lwodDriveRPSStr == "" {
+		lwodDriveRPSStr = "10"
+	}
+	cfg.LWODDriveRPS, err = strconv.ParseFloat(lwodDriveRPSStr, 64)
+	if err != nil {
+		log.Fatalf("strconv error: %s", err)
+	}
+	// LWOD_DELAY used to be the time between fetching spreadsheets
+	if cfg.LWODDelay > 0 {
+		cfg.LWODSheetsRPS = 1 / float64(cfg.LWODDelay)
+	}
+	lwodSheetsRPSStr := os.Getenv("LWOD_SHEETS_RPS")
+	if lwodSheetsRPSStr != "" {
+		cfg.LWODSheetsRPS, err = strconv.ParseFloat(lwodSheetsRPSStr, 64)
+		if err != nil {
+			log.Fatalf("strconv error: %s", err)
+		}
+	}
+	lwodFullScanHoursStr := os.Getenv("LWOD_FULL_SCAN_HOURS")
+	if lwodFullScanHoursStr == "" {
+		lwodFullScanHoursStr = "24"
+	}
+	cfg.LWODFullScanHours, err = strconv.Atoi(lwodFullScanHoursStr)
+	if err != nil {
+		log.Fatalf("strconv error: %s", err)
+	}
+	cfg.LWODSnapshotDir = os.Getenv("LWOD_SNAPSHOT_DIR")
+	lwodSnapshotRetentionStr := os.Getenv("LWOD_SNAPSHOT_RETENTION_DAYS")
+	if lwodSnapshotRetentionStr == "" {
+		lwodSnapshotRetentionStr = "0"
+	}
+	cfg.LWODSnapshotRetention, err = strconv.Atoi(lwodSnapshotRetentionStr)
+	if err != nil {
+		log.Fatalf("strconv error: %s", err)
+	}
+	lwodSnapshotKeepStr := os.Getenv("LWOD_SNAPSHOT_KEEP")
+	if lwodSnapshotKeepStr == "" {
+		lwodSnapshotKeepStr = "1"
+	}
+	cfg.LWODSnapshotKeep, err = strconv.Atoi(lwodSnapshotKeepStr)
+	if err != nil {
+		log.Fatalf("strconv error: %s", err)
+	}
+	if cfg.LWODSnapshotRetention < 0 || cfg.LWODSnapshotKeep < 0 {
+		log.Fatalf("LWOD_SNAPSHOT_RETENTION_DAYS and LWOD_SNAPSHOT_KEEP can't be negative")
+	}
 	lwodrefreshStr := os.Getenv("LWOD_REFRESH")
 	if lwodrefreshStr == "" {
 		lwodrefreshStr = "0"
@@ -253,20 +781,9 @@ func LoadDotEnv() Config {
 	return cfg
 }
 
-func LoadDatabase(config *Config) {
-	log.Debugf("Connecting to databases")
-	dbpath := filepath.Join(".", "db")
-	err := os.MkdirAll(dbpath, os.ModePerm)
-	if err != nil {
-		log.Fatalf("Error creating a db directory: %s", err)
-	}
-
-	dbpath = filepath.Join(".", "db", config.LWODDBFile)
-	config.LWODDBConfig.DB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?_fk=true", dbpath))
-	if err != nil {
-		log.Fatalf("Error opening/creating lwoddb: %s", err)
-	}
-
+// migrateLWODDatabase creates the tables of the LWOD DB that aren't there
+// yet and brings the ones that are up to date.
+func migrateLWODDatabase(config *Config) {
 	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateYouTube); err != nil {
 		log.Fatalf("Error creating the YouTube table: %s", err)
 	}
@@ -287,25 +804,135 @@ func LoadDatabase(config *Config) {
 		log.Fatalf("Error creating the Odysee table: %s", err)
 	}
 
+	for _, table := range lwodPlatformTables {
+		if err := addColumns(config.LWODDBConfig.DB, table, sqlPlatformColumns); err != nil {
+			log.Fatalf("Error migrating the %s table: %s", table, err)
+		}
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateGames); err != nil {
+		log.Fatalf("Error creating the games table: %s", err)
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateGameAliases); err != nil {
+		log.Fatalf("Error creating the game_aliases table: %s", err)
+	}
+
 	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateMain); err != nil {
 		log.Fatalf("Error creating the lwod table: %s", err)
 	}
 
+	ok, err := hasColumn(config.LWODDBConfig.DB, "lwod", "id")
+	if err != nil {
+		log.Fatalf("Error checking the lwod table: %s", err)
+	}
+	if !ok {
+		log.Infof("Adding the id column to the lwod table")
+		if err := migrate(config.LWODDBConfig.DB, sqlMigrateMainID); err != nil {
+			log.Fatalf("Error migrating the lwod table: %s", err)
+		}
+	}
+
+	if err := addColumns(config.LWODDBConfig.DB, "lwod", sqlMainColumns); err != nil {
+		log.Fatalf("Error migrating the lwod table: %s", err)
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateNotes); err != nil {
+		log.Fatalf("Error creating the notes table: %s", err)
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateSubjects); err != nil {
+		log.Fatalf("Error creating the subjects table: %s", err)
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateSubjectAliases); err != nil {
+		log.Fatalf("Error creating the subject_aliases table: %s", err)
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateLWODSubjects); err != nil {
+		log.Fatalf("Error creating the lwod_subjects table: %s", err)
+	}
+
+	if err := migrate(config.LWODDBConfig.DB, sqlCreateHistory); err != nil {
+		log.Fatalf("Error creating the lwod_history table: %s", err)
+	}
+
+	config.LWODDBConfig.FTS, err = createFTS(config.LWODDBConfig.DB)
+	if err != nil {
+		log.Fatalf("Error creating the lwod_fts table: %s", err)
+	}
+	if !config.LWODDBConfig.FTS {
+		log.Debugf("SQLite was built without FTS5 (the sqlite_fts5 build tag), search won't work")
+	}
+
 	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateLink); err != nil {
 		log.Fatalf("Error creating the link table: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectYTHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM youtube WHERE id = ? LIMIT 1")
-	if err != nil {
-		log.Fatalf("Error preparing a db statement: %s", err)
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateParseErrors); err != nil {
+		log.Fatalf("Error creating the parse_errors table: %s", err)
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateState); err != nil {
+		log.Fatalf("Error creating the lwod_state table: %s", err)
+	}
+
+	if _, err := config.LWODDBConfig.DB.Exec(sqlCreateSheets); err != nil {
+		log.Fatalf("Error creating the sheets table: %s", err)
+	}
+}
+
+// LoadDatabase opens the LWOD DB and, unless it's a dry run, the YT DB.
+func LoadDatabase(config *Config) {
+	log.Debugf("Connecting to databases")
+	LoadLWODDatabase(config)
+	// dry runs of lwod don't use the YT DB
+	if !config.Flags.DryRun {
+		LoadYTDatabase(config)
 	}
+	log.Debugf("Connected to the databases successfully")
+}
 
-	config.LWODDBConfig.Statements.SelectYTByHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT id FROM youtube WHERE hash = ? LIMIT 1")
+// LoadLWODDatabase opens the LWOD DB (--db for replays), migrating it unless
+// it's a dry run, along with the snapshot store if there is one.
+func LoadLWODDatabase(config *Config) {
+	var err error
+	if !config.Flags.DryRun && config.Flags.DB == "" {
+		err = os.MkdirAll(filepath.Join(".", "db"), os.ModePerm)
+		if err != nil {
+			log.Fatalf("Error creating a db directory: %s", err)
+		}
+	}
+
+	dbpath := filepath.Join(".", "db", config.LWODDBFile)
+	// replays go to a DB of their own
+	if config.Flags.DB != "" {
+		dbpath = config.Flags.DB
+	}
+	// dry runs can't change the DB, not even by migrating it
+	options := "_fk=true"
+	if config.Flags.DryRun {
+		options += "&mode=ro"
+	}
+	config.LWODDBConfig.DB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?%s", dbpath, options))
 	if err != nil {
-		log.Fatalf("Error preparing a db statement: %s", err)
+		log.Fatalf("Error opening/creating lwoddb: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.DeleteYTStmt, err = config.LWODDBConfig.DB.Prepare("DELETE FROM youtube WHERE id = ?")
+	if config.Flags.DryRun {
+		// the DB has to be there already, there's nothing to preview otherwise
+		migrated, err := lwodMigrated(config.LWODDBConfig.DB)
+		if err != nil {
+			log.Fatalf("Error opening lwoddb read-only (run lwod without --dry-run once to create it): %s", err)
+		}
+		if !migrated {
+			log.Fatalf("lwoddb was created by an older version, run lwod without --dry-run once to migrate it")
+		}
+	} else {
+		migrateLWODDatabase(config)
+	}
+
+	config.LWODDBConfig.Statements.SelectYTHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM youtube WHERE id = ? LIMIT 1")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
@@ -315,92 +942,95 @@ func LoadDatabase(config *Config) {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectTwitchByHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT id FROM twitch WHERE hash = ? LIMIT 1")
+	config.LWODDBConfig.Statements.SelectRumbleHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM rumble WHERE id = ? LIMIT 1")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.DeleteTwitchStmt, err = config.LWODDBConfig.DB.Prepare("DELETE FROM twitch WHERE id = ?")
+	config.LWODDBConfig.Statements.SelectKickHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM kick WHERE id = ? LIMIT 1")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectRumbleHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM rumble WHERE id = ? LIMIT 1")
+	config.LWODDBConfig.Statements.SelectOdyseeHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM odysee WHERE id = ? LIMIT 1")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectRumbleByHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT id FROM rumble WHERE hash = ? LIMIT 1")
+	config.LWODDBConfig.Statements.UpsertYTStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO youtube (id, hash) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET hash = excluded.hash, removed_at = NULL")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.DeleteRumbleStmt, err = config.LWODDBConfig.DB.Prepare("DELETE FROM rumble WHERE id = ?")
+	config.LWODDBConfig.Statements.UpsertTwitchStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO twitch (id, hash) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET hash = excluded.hash, removed_at = NULL")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectKickHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM kick WHERE id = ? LIMIT 1")
+	config.LWODDBConfig.Statements.UpsertRumbleStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO rumble (id, hash) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET hash = excluded.hash, removed_at = NULL")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectKickByHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT id FROM kick WHERE hash = ? LIMIT 1")
+	config.LWODDBConfig.Statements.UpsertKickStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO kick (id, hash) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET hash = excluded.hash, removed_at = NULL")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.DeleteKickStmt, err = config.LWODDBConfig.DB.Prepare("DELETE FROM kick WHERE id = ?")
+	config.LWODDBConfig.Statements.UpsertOdyseeStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO odysee (id, hash) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET hash = excluded.hash, removed_at = NULL")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectOdyseeHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT hash FROM odysee WHERE id = ? LIMIT 1")
+	config.LWODDBConfig.Statements.InsertURLStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO lwodUrl (date, sheetId) VALUES (?, ?) ON CONFLICT DO NOTHING")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.SelectOdyseeByHashStmt, err = config.LWODDBConfig.DB.Prepare("SELECT id FROM odysee WHERE hash = ? LIMIT 1")
+	config.LWODDBConfig.Statements.InsertParseErrorStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO parse_errors (time, sheetid, worksheet, row, col, value, error) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.DeleteOdyseeStmt, err = config.LWODDBConfig.DB.Prepare("DELETE FROM odysee WHERE id = ?")
+	config.LWODDBConfig.Statements.SelectStateStmt, err = config.LWODDBConfig.DB.Prepare("SELECT value FROM lwod_state WHERE key = ? LIMIT 1")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.InsertYTStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO youtube (id, hash) VALUES (?, ?)")
+	config.LWODDBConfig.Statements.UpsertStateStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO lwod_state (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.InsertTwitchStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO twitch (id, hash) VALUES (?, ?)")
+	config.LWODDBConfig.Statements.SelectSheetVersionStmt, err = config.LWODDBConfig.DB.Prepare("SELECT version FROM sheets WHERE id = ? LIMIT 1")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.InsertRumbleStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO rumble (id, hash) VALUES (?, ?)")
+	config.LWODDBConfig.Statements.UpsertSheetStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO sheets (id, name, folder, modifiedtime, version, lastparsed) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET name = excluded.name, folder = excluded.folder, modifiedtime = excluded.modifiedtime, version = excluded.version, lastparsed = excluded.lastparsed")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.InsertKickStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO kick (id, hash) VALUES (?, ?)")
+	config.LWODDBConfig.Statements.InsertHistoryStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO lwod_history (runid, time, lwodid, action, old, new) VALUES (?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
 
-	config.LWODDBConfig.Statements.InsertOdyseeStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO odysee (id, hash) VALUES (?, ?)")
-	if err != nil {
-		log.Fatalf("Error preparing a db statement: %s", err)
+	// dry runs don't archive the spreadsheets
+	if config.LWODSnapshotDir != "" && !config.Flags.DryRun {
+		LoadSnapshotDatabase(config)
 	}
+}
 
-	config.LWODDBConfig.Statements.InsertURLStmt, err = config.LWODDBConfig.DB.Prepare("INSERT INTO lwodUrl (date, sheetId) VALUES (?, ?) ON CONFLICT DO NOTHING")
+// LoadYTDatabase opens (creating it if needed) the YT DB.
+func LoadYTDatabase(config *Config) {
+	err := os.MkdirAll(filepath.Join(".", "db"), os.ModePerm)
 	if err != nil {
-		log.Fatalf("Error preparing a db statement: %s", err)
+		log.Fatalf("Error creating a db directory: %s", err)
 	}
 
-	dbpath = filepath.Join(".", "db", config.YTDBFile)
+	dbpath := filepath.Join(".", "db", config.YTDBFile)
 	config.YTDBConfig.DB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?_fk=true", dbpath))
 	if err != nil {
 		log.Fatalf("Error opening/creating ytvoddb: %s", err)
@@ -459,8 +1089,41 @@ func LoadDatabase(config *Config) {
 	if err != nil {
 		log.Fatalf("Error preparing a db statement: %s", err)
 	}
+}
 
-	log.Debugf("Connected to the databases successfully")
+// LoadSnapshotDatabase opens (creating it if needed) the index of the
+// snapshot store in LWOD_SNAPSHOT_DIR. The store being replayed (--snapshots)
+// is only read, so it's opened read-only instead.
+func LoadSnapshotDatabase(config *Config) {
+	var err error
+	if config.Flags.Snapshots != "" {
+		dbpath := filepath.Join(config.Flags.Snapshots, "snapshots.db")
+		config.SnapshotDBConfig.DB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?_fk=true&mode=ro", dbpath))
+		if err != nil {
+			log.Fatalf("Error opening the snapshot db: %s", err)
+		}
+		return
+	}
+
+	err = os.MkdirAll(config.LWODSnapshotDir, os.ModePerm)
+	if err != nil {
+		log.Fatalf("Error creating the snapshot directory: %s", err)
+	}
+
+	dbpath := filepath.Join(config.LWODSnapshotDir, "snapshots.db")
+	config.SnapshotDBConfig.DB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?_fk=true", dbpath))
+	if err != nil {
+		log.Fatalf("Error opening/creating the snapshot db: %s", err)
+	}
+
+	if err := migrate(config.SnapshotDBConfig.DB, sqlCreateSnapshots); err != nil {
+		log.Fatalf("Error creating the snapshots table: %s", err)
+	}
+
+	config.SnapshotDBConfig.Statements.InsertSnapshotStmt, err = config.SnapshotDBConfig.DB.Prepare("INSERT INTO snapshots (runid, fetched, sheetid, name, folder, sheetkey, modifiedtime, version, hash, size) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Fatalf("Error preparing a db statement: %s", err)
+	}
 }
 
 func CreateGoogleClients(config *Config) {
@@ -479,6 +1142,7 @@ func CreateGoogleClients(config *Config) {
 		log.Fatalf("Unable to parse client secret file to config: %v", err)
 	}
 	client := cfg.Client(ctx)
+	config.GoogleConfig.HTTP = client
 
 	config.GoogleConfig.Sheets, err = sheets.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
@@ -498,9 +1162,23 @@ func CreateGoogleClients(config *Config) {
 	log.Debugf("Created Google API clients successfully")
 }
 
-func Initialize() Config {
+func Initialize(flags Flags) Config {
 	cfg := LoadDotEnv()
+	cfg.Flags = flags
 	CreateGoogleClients(&cfg)
 	LoadDatabase(&cfg)
 	return cfg
 }
+
+// InitializeOffline is Initialize without the Google API clients and the YT
+// DB, for the modes that never talk to Google. Only the LWOD settings are
+// loaded.
+func InitializeOffline(flags Flags) Config {
+	cfg := LoadLWODDotEnv()
+	if cfg.LWODDBFile == "" {
+		log.Fatalf("Please set the LWOD_DB_FILE environment variable and restart the app")
+	}
+	cfg.Flags = flags
+	LoadLWODDatabase(&cfg)
+	return cfg
+}
@@ -0,0 +1,129 @@
+package gsheets
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// catalog is a table of canonical names along with a table of their aliases,
+// seeded from an alias file and used to resolve what the editors typed.
+type catalog struct {
+	// Name is used in the logs
+	Name string
+	// Table has the canonical names (id, name), AliasTable maps the
+	// normalized aliases to them (alias, <IDColumn>)
+	Table, AliasTable, IDColumn string
+
+	ids map[string]int64
+}
+
+// normalizeName lowercases the name and collapses its whitespace, which is
+// how the aliases are stored.
+func normalizeName(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// seed makes the alias table match the aliases, adding the canonical names
+// that aren't in the table yet. Every canonical name is an alias of itself.
+func (c *catalog) seed(db *sql.DB, aliases map[string][]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't begin the Tx")
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s", c.AliasTable))
+	if err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't clear the %s aliases", c.Name))
+	}
+	for name, a := range aliases {
+		name = strings.TrimSpace(name)
+		var id int64
+		err := tx.QueryRow(fmt.Sprintf("INSERT INTO %s (name) VALUES (?) ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id", c.Table), name).Scan(&id)
+		if err != nil {
+			tx.Rollback()
+			return WrapWithLWODError(err, fmt.Sprintf(`Couldn't insert %s "%s"`, c.Name, name))
+		}
+		for _, alias := range append([]string{name}, a...) {
+			_, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (alias, %s) VALUES (?, ?) ON CONFLICT (alias) DO NOTHING", c.AliasTable, c.IDColumn), normalizeName(alias), id)
+			if err != nil {
+				tx.Rollback()
+				return WrapWithLWODError(err, fmt.Sprintf(`Couldn't insert %s alias "%s"`, c.Name, alias))
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// load reads the aliases from the DB.
+func (c *catalog) load(db *sql.DB) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT alias, %s FROM %s", c.IDColumn, c.AliasTable))
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the %s aliases", c.Name))
+	}
+	defer rows.Close()
+
+	c.ids = make(map[string]int64)
+	for rows.Next() {
+		var alias string
+		var id int64
+		if err := rows.Scan(&alias, &id); err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the %s aliases", c.Name))
+		}
+		c.ids[alias] = id
+	}
+
+	return rows.Err()
+}
+
+// loadNames makes the canonical names resolve to themselves even if they're
+// not in the alias table, which is the case for names added with add.
+func (c *catalog) loadNames(db *sql.DB) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT id, name FROM %s", c.Table))
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the %s names", c.Name))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the %s names", c.Name))
+		}
+		if _, ok := c.ids[normalizeName(name)]; !ok {
+			c.ids[normalizeName(name)] = id
+		}
+	}
+
+	return rows.Err()
+}
+
+// add resolves the name, adding it as a new canonical name if it's not an
+// alias of any.
+func (c *catalog) add(tx *sql.Tx, name string) (int64, error) {
+	if id := c.resolve(name); id.Valid {
+		return id.Int64, nil
+	}
+
+	var id int64
+	name = strings.Join(strings.Fields(name), " ")
+	err := tx.QueryRow(fmt.Sprintf("INSERT INTO %s (name) VALUES (?) ON CONFLICT (name) DO UPDATE SET name = excluded.name RETURNING id", c.Table), name).Scan(&id)
+	if err != nil {
+		return 0, WrapWithLWODError(err, fmt.Sprintf(`Couldn't insert %s "%s"`, c.Name, name))
+	}
+	c.ids[normalizeName(name)] = id
+
+	return id, nil
+}
+
+// resolve returns the ID of the canonical name the string is an alias of.
+func (c *catalog) resolve(s string) sql.NullInt64 {
+	id, ok := c.ids[normalizeName(s)]
+	if !ok {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: id, Valid: true}
+}
@@ -0,0 +1,339 @@
+package gsheets
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+	"google.golang.org/api/googleapi"
+)
+
+// the lwod_state keys of the Drive changes page token, of when the sheets
+// were last scanned instead and of the folders found by that scan
+const (
+	stateDrivePageToken = "drive_page_token"
+	stateLastFullScan   = "last_full_scan"
+	stateLayoutFolders  = "layout_folders"
+)
+
+// ErrInvalidPageToken is returned by a ChangeSource when it doesn't accept the
+// page token anymore and the changes have to be tracked from scratch.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// ChangeSource is a SheetSource that can tell which files changed since the
+// point in time marked by a page token.
+type ChangeSource interface {
+	SheetSource
+	// StartPageToken returns the page token for the changes made from now on.
+	StartPageToken() (string, error)
+	// Changes returns the files that changed since the page token, along with
+	// the page token to use next time. Removed and trashed files are left out.
+	Changes(pageToken string) ([]SheetFile, string, error)
+}
+
+func (s *DriveSource) StartPageToken() (string, error) {
+	result, err := s.config.GoogleConfig.Drive.Changes.GetStartPageToken().Do()
+	if err != nil {
+		return "", WrapWithLWODError(err, "Drive error")
+	}
+
+	return result.StartPageToken, nil
+}
+
+func (s *DriveSource) Changes(pageToken string) ([]SheetFile, string, error) {
+	var files []SheetFile
+	for {
+		result, err := s.config.GoogleConfig.Drive.Changes.List(pageToken).PageSize(1000).Fields("nextPageToken,newStartPageToken,changes(removed,file(id,name,mimeType,parents,trashed,modifiedTime,version))").Do()
+		if err != nil {
+			var apiErr *googleapi.Error
+			if errors.As(err, &apiErr) && (apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusNotFound) {
+				return nil, "", WrapWithLWODError(fmt.Errorf("%w: %v", ErrInvalidPageToken, err), "Drive error")
+			}
+			return nil, "", WrapWithLWODError(err, "Drive error")
+		}
+
+		for _, c := range result.Changes {
+			if c.Removed || c.File == nil || c.File.Trashed {
+				continue
+			}
+			files = append(files, SheetFile{
+				ID:       c.File.Id,
+				Name:     c.File.Name,
+				MimeType: c.File.MimeType,
+				Parents:  c.File.Parents,
+
+				ModifiedTime: c.File.ModifiedTime,
+				Version:      c.File.Version,
+			})
+		}
+
+		if result.NewStartPageToken != "" {
+			return files, result.NewStartPageToken, nil
+		}
+		if result.NextPageToken == "" {
+			return nil, "", WrapWithLWODError(fmt.Errorf("no next page token or new start page token"), "Drive error")
+		}
+		pageToken = result.NextPageToken
+	}
+}
+
+// CollectChangedSheets returns the LWOD spreadsheets that changed since the
+// page token saved in the DB, along with the page token to save once they're
+// parsed. Without a usable page token, or if the sheets haven't been scanned
+// for LWOD_FULL_SCAN_HOURS, it falls back to CollectSheets, scanned being
+// true then.
+func CollectChangedSheets(src ChangeSource, config *config.Config) (map[string]LWODSheet, string, bool, error) {
+	var pageToken string
+	err := config.LWODDBConfig.Statements.SelectStateStmt.QueryRow(stateDrivePageToken).Scan(&pageToken)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, "", false, WrapWithLWODError(err, "Couldn't get the Drive changes page token")
+	}
+	scanDue, err := fullScanDue(config)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	folders, err := loadLayoutFolders(config)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	switch {
+	case pageToken == "":
+		log.Infof("[LWOD] No Drive changes page token saved yet, scanning the sheets")
+	case scanDue:
+		// in case a change didn't make it into the Drive changes
+		log.Infof("[LWOD] The sheets haven't been scanned in %d hour(s), scanning them", config.LWODFullScanHours)
+	case folders == nil:
+		log.Infof("[LWOD] No LWOD folders saved yet, scanning the sheets")
+	default:
+		changed, newPageToken, err := src.Changes(pageToken)
+		switch {
+		case err == nil && folders.changed(changed):
+			log.Infof("[LWOD] The LWOD folders changed in Drive since the last run, scanning the sheets")
+		case err == nil:
+			lwod := changedLWODSheets(changed, folders, config)
+			log.Infof("[LWOD] %d file(s) changed in Drive since the last run, %d of them LWOD spreadsheets", len(changed), len(lwod))
+			return lwod, newPageToken, false, nil
+		case errors.Is(err, ErrInvalidPageToken):
+			log.Warnf("[LWOD] The Drive changes page token isn't valid anymore, falling back to scanning the sheets: %s", err)
+		default:
+			return nil, "", false, err
+		}
+	}
+
+	// getting the page token before the scan, so nothing that changes during it
+	// gets missed next time
+	newPageToken, err := src.StartPageToken()
+	if err != nil {
+		return nil, "", false, err
+	}
+	// the folders are saved to match the changes against until the next scan
+	leaves, ids, err := newSheetLayout(config).walkFolders(src, config.LWODFolder, nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !config.Flags.DryRun {
+		if err := saveLayoutFolders(newSavedFolders(leaves, ids), config); err != nil {
+			return nil, "", false, err
+		}
+	}
+	lwod, err := CollectSheets(src, config)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	return lwod, newPageToken, true, nil
+}
+
+// fullScanDue reports whether the sheets haven't been scanned for
+// LWOD_FULL_SCAN_HOURS.
+func fullScanDue(config *config.Config) (bool, error) {
+	if config.LWODFullScanHours <= 0 {
+		return false, nil
+	}
+
+	var lastScan string
+	err := config.LWODDBConfig.Statements.SelectStateStmt.QueryRow(stateLastFullScan).Scan(&lastScan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, WrapWithLWODError(err, "Couldn't get the time of the last full scan")
+	}
+	t, err := time.Parse(time.RFC3339, lastScan)
+	if err != nil {
+		return true, nil
+	}
+
+	return time.Since(t) >= time.Duration(config.LWODFullScanHours)*time.Hour, nil
+}
+
+// SavePageToken saves the Drive changes page token for the next run, and the
+// time of the scan if the sheets were scanned.
+func SavePageToken(pageToken string, scanned bool, config *config.Config) error {
+	if scanned {
+		_, err := config.LWODDBConfig.Statements.UpsertStateStmt.Exec(stateLastFullScan, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return WrapWithLWODError(err, "Couldn't save the time of the full scan")
+		}
+	}
+	_, err := config.LWODDBConfig.Statements.UpsertStateStmt.Exec(stateDrivePageToken, pageToken)
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't save the Drive changes page token")
+	}
+
+	return nil
+}
+
+// savedFolders is the folders of the LWOD layout as of the last scan of the
+// sheets, kept in lwod_state so the Drive changes can be matched against
+// them without walking the folders every run.
+type savedFolders struct {
+	// All is the IDs of every folder of the layout, the root included
+	All []string
+	// Leaves is the folders the spreadsheets are in
+	Leaves []savedFolder
+}
+
+type savedFolder struct {
+	ID   string
+	Date sheetDate
+}
+
+func newSavedFolders(leaves []layoutFolder, ids []string) *savedFolders {
+	folders := &savedFolders{All: ids}
+	for _, leaf := range leaves {
+		folders.Leaves = append(folders.Leaves, savedFolder{leaf.ID, leaf.date})
+	}
+	return folders
+}
+
+// changed reports whether any of the changed files is a folder of the
+// layout, or a folder inside one of them, so the folders have to be walked
+// again.
+func (f *savedFolders) changed(files []SheetFile) bool {
+	known := make(map[string]bool, len(f.All))
+	for _, id := range f.All {
+		known[id] = true
+	}
+	for _, file := range files {
+		if file.MimeType != mimeFolder {
+			continue
+		}
+		if known[file.ID] {
+			return true
+		}
+		for _, parent := range file.Parents {
+			if known[parent] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadLayoutFolders reads the folders saved by the last scan, nil if there
+// aren't any.
+func loadLayoutFolders(config *config.Config) (*savedFolders, error) {
+	var value string
+	err := config.LWODDBConfig.Statements.SelectStateStmt.QueryRow(stateLayoutFolders).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Couldn't get the LWOD folders")
+	}
+
+	var folders savedFolders
+	if err := json.Unmarshal([]byte(value), &folders); err != nil {
+		log.Warnf("[LWOD] Couldn't read the saved LWOD folders, they'll be walked again: %s", err)
+		return nil, nil
+	}
+	return &folders, nil
+}
+
+func saveLayoutFolders(folders *savedFolders, config *config.Config) error {
+	value, err := json.Marshal(folders)
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't encode the LWOD folders")
+	}
+	_, err = config.LWODDBConfig.Statements.UpsertStateStmt.Exec(stateLayoutFolders, string(value))
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't save the LWOD folders")
+	}
+
+	return nil
+}
+
+// changedLWODSheets picks the spreadsheets in the saved leaf folders out of
+// the changed files, keying the ones in the current month window the same
+// way CollectSheets does and the rest by their year and month.
+func changedLWODSheets(changed []SheetFile, saved *savedFolders, config *config.Config) map[string]LWODSheet {
+	lwod := make(map[string]LWODSheet)
+	layout := newSheetLayout(config)
+	folders := make(map[string]layoutFolder, len(saved.Leaves))
+	for _, folder := range saved.Leaves {
+		folders[folder.ID] = layoutFolder{ID: folder.ID, date: folder.Date}
+	}
+
+	today := time.Now()
+	var unrecognized []SheetFile
+	for _, sheet := range changed {
+		if sheet.MimeType != mimeSpreadsheet {
+			continue
+		}
+		for _, parent := range sheet.Parents {
+			folder, ok := folders[parent]
+			if !ok {
+				continue
+			}
+			found, ok := layout.parseSheet(sheet, folder)
+			if !ok {
+				unrecognized = append(unrecognized, sheet)
+				break
+			}
+			key := windowKey(found.date, today)
+			if key == "" {
+				key = found.date.key()
+			}
+			lwod[key] = newLWODSheet(sheet, parent, found.date)
+			break
+		}
+	}
+	reportUnrecognized(unrecognized)
+
+	return lwod
+}
+
+type windowMonth struct {
+	key  string
+	date time.Time
+}
+
+// monthWindow is the months that get parsed by default, in the order their
+// keys take precedence.
+func monthWindow(today time.Time) []windowMonth {
+	return []windowMonth{
+		{"Today", today},
+		{"OneMonthAgo", today.AddDate(0, -1, 0)},
+		{"PlusSixDays", today.AddDate(0, 0, 6)},
+	}
+}
+
+// windowKey is the key of the month window the date is in, or an empty string
+// if it's outside of it.
+func windowKey(d sheetDate, today time.Time) string {
+	for _, w := range monthWindow(today) {
+		if w.date.Year() == d.Year && w.date.Month() == d.Month {
+			return w.key
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,104 @@
+package gsheets
+
+import (
+	"testing"
+	"time"
+)
+
+// changesSource is a MemorySource that reports the files in changed as the
+// changes, counting how many times the folders were listed.
+type changesSource struct {
+	*MemorySource
+	changed []SheetFile
+	listed  int
+}
+
+func (s *changesSource) ListFiles(parentID string) ([]SheetFile, error) {
+	s.listed++
+	return s.MemorySource.ListFiles(parentID)
+}
+
+func (s *changesSource) StartPageToken() (string, error) {
+	return "token", nil
+}
+
+func (s *changesSource) Changes(pageToken string) ([]SheetFile, string, error) {
+	return s.changed, "token", nil
+}
+
+func TestCollectChangedSheetsFullScan(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LWODFullScanHours = 24
+	src := &changesSource{MemorySource: NewMemorySource()}
+
+	collect := func() bool {
+		t.Helper()
+		_, pageToken, scanned, err := CollectChangedSheets(src, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SavePageToken(pageToken, scanned, cfg); err != nil {
+			t.Fatal(err)
+		}
+		return scanned
+	}
+
+	if !collect() {
+		t.Errorf("the sheets weren't scanned without a page token")
+	}
+	if collect() {
+		t.Errorf("the sheets were scanned again right after the last scan")
+	}
+
+	lastScan := time.Now().UTC().Add(-25 * time.Hour).Format(time.RFC3339)
+	if _, err := cfg.LWODDBConfig.Statements.UpsertStateStmt.Exec(stateLastFullScan, lastScan); err != nil {
+		t.Fatal(err)
+	}
+	if !collect() {
+		t.Errorf("the sheets weren't scanned 25 hours after the last scan")
+	}
+
+	cfg.LWODFullScanHours = 0
+	if _, err := cfg.LWODDBConfig.Statements.UpsertStateStmt.Exec(stateLastFullScan, lastScan); err != nil {
+		t.Fatal(err)
+	}
+	if collect() {
+		t.Errorf("the sheets were scanned with LWOD_FULL_SCAN_HOURS set to 0")
+	}
+}
+
+func TestCollectChangedSheetsFolders(t *testing.T) {
+	cfg := testConfig(t)
+	src := &changesSource{MemorySource: NewMemorySource()}
+	src.AddFolder("root", "folder2023", "2023")
+	src.AddSpreadsheet("folder2023", "03 March", testSpreadsheet("SHEET1", testHeader))
+
+	if _, pageToken, scanned, err := CollectChangedSheets(src, cfg); err != nil || !scanned {
+		t.Fatalf("the first run didn't scan the sheets (%v)", err)
+	} else if err := SavePageToken(pageToken, scanned, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	src.listed = 0
+	src.changed = []SheetFile{
+		{ID: "SHEET1", Name: "03 March", MimeType: mimeSpreadsheet, Parents: []string{"folder2023"}},
+		{ID: "OTHER", Name: "03 March", MimeType: mimeSpreadsheet, Parents: []string{"elsewhere"}},
+		{ID: "folder", Name: "2023", MimeType: mimeFolder, Parents: []string{"elsewhere"}},
+	}
+	lwod, _, scanned, err := CollectChangedSheets(src, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned || src.listed != 0 {
+		t.Errorf("the folders were listed %d time(s) for changed spreadsheets", src.listed)
+	}
+	if len(lwod) != 1 || lwod["2023-03"].ID != "SHEET1" {
+		t.Errorf("got %+v, want just SHEET1 as 2023-03", lwod)
+	}
+
+	// a new year folder
+	src.changed = []SheetFile{{ID: "folder2024", Name: "2024", MimeType: mimeFolder, Parents: []string{"root"}}}
+	if _, _, scanned, err := CollectChangedSheets(src, cfg); err != nil || !scanned {
+		t.Errorf("a new folder in the LWOD folder didn't get the sheets scanned (%v)", err)
+	}
+}
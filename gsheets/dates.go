@@ -0,0 +1,159 @@
+package gsheets
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// worksheetPatterns are the worksheet names that narrow the month of the
+// spreadsheet down ("July", "Jul 2023", "2023-07"). Plain numbers aren't
+// among them, those are more likely to be weeks.
+var worksheetPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?P<year>\d{4})\s*[-_./]\s*(?P<month>\d{1,2})\b`),
+	regexp.MustCompile(`^(?P<month>[[:alpha:]]{3,})\.?\s*[-_,]?\s*(?P<year>\d{4})\b`),
+	regexp.MustCompile(`^(?P<month>[[:alpha:]]{3,})\b`),
+}
+
+var streamDateRegex = regexp.MustCompile(`^(\d{1,2})\s*/\s*(\d{1,2})\s*/\s*(\d{2}|\d{4})$`)
+
+// the day the Sheets serial dates count from
+var serialEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+func (d sheetDate) String() string {
+	if d.Year == 0 {
+		return d.Month.String()
+	}
+	return fmt.Sprintf("%s %d", d.Month, d.Year)
+}
+
+// contains reports whether the date is in the month, any year matching if
+// the year isn't known.
+func (d sheetDate) contains(t time.Time) bool {
+	return t.Month() == d.Month && (d.Year == 0 || t.Year() == d.Year)
+}
+
+// distance is how many months away from the month the date is.
+func (d sheetDate) distance(t time.Time) int {
+	year := d.Year
+	if year == 0 {
+		year = t.Year()
+	}
+	diff := t.Year()*12 + int(t.Month()) - (year*12 + int(d.Month))
+	if diff < 0 {
+		return -diff
+	}
+	return diff
+}
+
+// sheetMonth is the month the spreadsheet is for: the one it was collected
+// for, the one in its key or the one in its name, in that order. The year
+// or the whole date are 0 if they couldn't be figured out.
+func sheetMonth(sheetKey string, sheet LWODSheet, layout sheetLayout) sheetDate {
+	if sheet.Month != 0 {
+		return sheetDate{sheet.Year, sheet.Month}
+	}
+	if t, err := time.Parse("2006-01", sheetKey); err == nil {
+		return sheetDate{t.Year(), t.Month()}
+	}
+	for _, re := range layout.sheets {
+		if date, ok := matchDate(re, sheet.Name, sheetDate{}); ok && date.Month != 0 {
+			return date
+		}
+	}
+
+	return sheetDate{}
+}
+
+// worksheetMonth narrows the month of the spreadsheet down with the name of
+// the worksheet.
+func worksheetMonth(title string, month sheetDate) sheetDate {
+	for _, re := range worksheetPatterns {
+		if date, ok := matchDate(re, title, month); ok && date.Month != 0 {
+			return date
+		}
+	}
+
+	return month
+}
+
+// serialDate reads the Sheets serial date of a cell that holds a number
+// formatted as a date.
+func serialDate(cell *sheets.CellData) (time.Time, bool) {
+	if cell.EffectiveValue == nil || cell.EffectiveValue.NumberValue == nil {
+		return time.Time{}, false
+	}
+	// numbers that aren't formatted as dates show up as they are
+	formatted := strings.TrimSpace(cell.FormattedValue)
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(formatted, ",", ""), 64); err == nil || formatted == "" {
+		return time.Time{}, false
+	}
+
+	date := serialEpoch.AddDate(0, 0, int(math.Floor(*cell.EffectiveValue.NumberValue)))
+	// times of day, percentages and such
+	if date.Year() < 2000 || date.Year() > 2100 {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// validDate is time.Date that doesn't roll invalid days over into the next
+// month.
+func validDate(year, month, day int) (time.Time, bool) {
+	if month < 1 || month > 12 || day < 1 {
+		return time.Time{}, false
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// streamDate reads the date cell of a row: a serial date if the cell is a
+// number formatted as a date, a d/m/y or an m/d/y date with a 2- or 4-digit
+// year otherwise. When both orders make a valid date, the one closest to the
+// month of the sheet wins, d/m/y if the month isn't known or it's a tie. ok
+// is false if the cell isn't a date at all.
+func streamDate(cell *sheets.CellData, month sheetDate) (time.Time, bool, error) {
+	if cell == nil {
+		return time.Time{}, false, nil
+	}
+	if date, ok := serialDate(cell); ok {
+		return date, true, nil
+	}
+
+	value := strings.TrimSpace(cell.FormattedValue)
+	if !strings.Contains(value, "/") {
+		return time.Time{}, false, nil
+	}
+	matches := streamDateRegex.FindStringSubmatch(value)
+	if matches == nil {
+		return time.Time{}, true, fmt.Errorf(`"%s" isn't a d/m/y or an m/d/y date`, value)
+	}
+	first, _ := strconv.Atoi(matches[1])
+	second, _ := strconv.Atoi(matches[2])
+	year, _ := parseYear(matches[3])
+
+	var candidates []time.Time
+	if date, ok := validDate(year, second, first); ok {
+		candidates = append(candidates, date)
+	}
+	if date, ok := validDate(year, first, second); ok {
+		candidates = append(candidates, date)
+	}
+	if len(candidates) == 0 {
+		return time.Time{}, true, fmt.Errorf(`"%s" isn't a valid date either way`, value)
+	}
+
+	best := candidates[0]
+	if month.Month != 0 && len(candidates) == 2 && month.distance(candidates[1]) < month.distance(best) {
+		best = candidates[1]
+	}
+	return best, true, nil
+}
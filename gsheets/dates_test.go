@@ -0,0 +1,133 @@
+package gsheets
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+func testDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func serialCell(n float64, formatted string) *sheets.CellData {
+	return &sheets.CellData{
+		FormattedValue: formatted,
+		EffectiveValue: &sheets.ExtendedValue{NumberValue: &n},
+	}
+}
+
+func TestStreamDate(t *testing.T) {
+	tests := []struct {
+		value string
+		month sheetDate
+		want  time.Time
+		ok    bool
+		err   bool
+	}{
+		// only one order makes a valid date
+		{"15/03/23", sheetDate{2023, time.March}, testDate(2023, time.March, 15), true, false},
+		{"03/15/23", sheetDate{2023, time.March}, testDate(2023, time.March, 15), true, false},
+		{"3/15/2023", sheetDate{}, testDate(2023, time.March, 15), true, false},
+		{" 15 / 3 / 23 ", sheetDate{}, testDate(2023, time.March, 15), true, false},
+
+		// both do, the one closest to the month of the sheet wins
+		{"03/04/23", sheetDate{2023, time.April}, testDate(2023, time.April, 3), true, false},
+		{"03/04/23", sheetDate{2023, time.March}, testDate(2023, time.March, 4), true, false},
+		{"07/03/23", sheetDate{Month: time.July}, testDate(2023, time.July, 3), true, false},
+		// at the year boundaries
+		{"01/12/23", sheetDate{2023, time.December}, testDate(2023, time.December, 1), true, false},
+		{"12/01/23", sheetDate{2023, time.December}, testDate(2023, time.December, 1), true, false},
+		{"01/12/23", sheetDate{2024, time.January}, testDate(2023, time.December, 1), true, false},
+		{"12/01/24", sheetDate{2024, time.January}, testDate(2024, time.January, 12), true, false},
+		{"01/12/24", sheetDate{2023, time.December}, testDate(2024, time.January, 12), true, false},
+		{"12/31/23", sheetDate{2024, time.January}, testDate(2023, time.December, 31), true, false},
+		// d/m/y when it's a tie or the month isn't known
+		{"01/01/24", sheetDate{2023, time.December}, testDate(2024, time.January, 1), true, false},
+		{"01/03/23", sheetDate{2023, time.February}, testDate(2023, time.March, 1), true, false},
+		{"03/04/23", sheetDate{}, testDate(2023, time.April, 3), true, false},
+
+		// not dates
+		{"", sheetDate{}, time.Time{}, false, false},
+		{"tbd", sheetDate{}, time.Time{}, false, false},
+		{"2023-03-15", sheetDate{}, time.Time{}, false, false},
+		// broken dates
+		{"32/13/23", sheetDate{}, time.Time{}, true, true},
+		{"31/02/23", sheetDate{}, time.Time{}, true, true},
+		{"15/03", sheetDate{}, time.Time{}, true, true},
+		{"15/03/023", sheetDate{}, time.Time{}, true, true},
+	}
+
+	for _, tt := range tests {
+		got, ok, err := streamDate(&sheets.CellData{FormattedValue: tt.value}, tt.month)
+		if !got.Equal(tt.want) || ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("streamDate(%q, %v) = %v, %v, %v, want %v, %v, error %v", tt.value, tt.month, got, ok, err, tt.want, tt.ok, tt.err)
+		}
+	}
+
+	// a serial date is taken as it is, whatever the month
+	got, ok, err := streamDate(serialCell(45000, "3/4/2023"), sheetDate{2023, time.April})
+	if want := testDate(2023, time.March, 15); !got.Equal(want) || !ok || err != nil {
+		t.Errorf("streamDate of a serial date = %v, %v, %v, want %v", got, ok, err, want)
+	}
+	if _, ok, err := streamDate(nil, sheetDate{}); ok || err != nil {
+		t.Errorf("streamDate(nil) = %v, %v, want nothing", ok, err)
+	}
+}
+
+func TestSerialDate(t *testing.T) {
+	tests := []struct {
+		cell *sheets.CellData
+		want time.Time
+		ok   bool
+	}{
+		{serialCell(45000, "15/03/2023"), testDate(2023, time.March, 15), true},
+		{serialCell(45000.75, "2023-03-15 18:00"), testDate(2023, time.March, 15), true},
+		{serialCell(45292, "Jan 1"), testDate(2024, time.January, 1), true},
+		// numbers that aren't formatted as dates
+		{serialCell(45000, "45000"), time.Time{}, false},
+		{serialCell(45000, "45,000"), time.Time{}, false},
+		{serialCell(45000, ""), time.Time{}, false},
+		// times of day and such
+		{serialCell(0.5, "12:00:00"), time.Time{}, false},
+		{serialCell(0.25, "25%"), time.Time{}, false},
+		{&sheets.CellData{FormattedValue: "15/03/2023"}, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := serialDate(tt.cell)
+		if !got.Equal(tt.want) || ok != tt.ok {
+			t.Errorf("serialDate(%q) = %v, %v, want %v, %v", tt.cell.FormattedValue, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWorksheetMonth(t *testing.T) {
+	march := sheetDate{2023, time.March}
+
+	tests := []struct {
+		title string
+		month sheetDate
+		want  sheetDate
+	}{
+		{"July", march, sheetDate{2023, time.July}},
+		{"jul", march, sheetDate{2023, time.July}},
+		{"Jul 2024", march, sheetDate{2024, time.July}},
+		{"2024-07", march, sheetDate{2024, time.July}},
+		{"December", sheetDate{}, sheetDate{Month: time.December}},
+		// the names that don't narrow it down
+		{"Sheet1", march, march},
+		{"Week 1", march, march},
+		{"1", march, march},
+		{"07", march, march},
+		{"Ju", march, march},
+		{"", march, march},
+	}
+
+	for _, tt := range tests {
+		if got := worksheetMonth(tt.title, tt.month); got != tt.want {
+			t.Errorf("worksheetMonth(%q, %v) = %v, want %v", tt.title, tt.month, got, tt.want)
+		}
+	}
+}
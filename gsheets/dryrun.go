@@ -0,0 +1,210 @@
+package gsheets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+type segmentField struct {
+	Name, Value string
+}
+
+func notesSummary(notes []LWODNote) string {
+	var s []string
+	for _, n := range notes {
+		s = append(s, n.Field+": "+n.Note)
+	}
+	return strings.Join(s, "; ")
+}
+
+// segmentKey is what a segment is recognized by: its VODs, start and end.
+func segmentKey(e LWODEntry) string {
+	return strings.Join([]string{e.YouTube, e.Twitch, e.Rumble, e.Kick, e.Odysee, e.Start, e.End}, "\x00")
+}
+
+// segmentDiff pairs up the old and the new segments of a VOD, the ones
+// without a pair being added or removed.
+type segmentDiff struct {
+	Added   []LWODEntry
+	Changed [][2]LWODEntry
+	Removed []LWODEntry
+}
+
+// diffSegments pairs the segments up by their segmentKey first, and what's
+// left by the row they came from, so a segment whose times were fixed is
+// still the same segment.
+func diffSegments(old, new []LWODEntry) segmentDiff {
+	var diff segmentDiff
+
+	pairs := make([]int, len(new))
+	for i := range pairs {
+		pairs[i] = -1
+	}
+	matched := make([]bool, len(old))
+	for _, key := range []func(LWODEntry) string{segmentKey, LWODEntry.source} {
+		unmatched := make(map[string][]int)
+		for i, e := range old {
+			if !matched[i] && key(e) != "" {
+				unmatched[key(e)] = append(unmatched[key(e)], i)
+			}
+		}
+		for j, e := range new {
+			k := key(e)
+			if pairs[j] >= 0 || k == "" || len(unmatched[k]) == 0 {
+				continue
+			}
+			pairs[j] = unmatched[k][0]
+			unmatched[k] = unmatched[k][1:]
+			matched[pairs[j]] = true
+		}
+	}
+
+	for j, e := range new {
+		switch {
+		case pairs[j] < 0:
+			diff.Added = append(diff.Added, e)
+		case len(changedFields(old[pairs[j]], e)) > 0:
+			diff.Changed = append(diff.Changed, [2]LWODEntry{old[pairs[j]], e})
+		}
+	}
+	for i, e := range old {
+		if !matched[i] {
+			diff.Removed = append(diff.Removed, e)
+		}
+	}
+
+	return diff
+}
+
+// changedFields compares everything about the segments, the times and the
+// date included - a segment paired up by its row can have them changed.
+func changedFields(old, new LWODEntry) []string {
+	var changes []string
+	oldFields, newFields := historyFields(old), historyFields(new)
+	for i := range oldFields {
+		if oldFields[i].Value != newFields[i].Value {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", oldFields[i].Name, oldFields[i].Value, newFields[i].Value))
+		}
+	}
+	return changes
+}
+
+func previewVODKey(platform lwodPlatform, id string) string {
+	return fmt.Sprintf("vod %s %s", platform.Column, id)
+}
+
+func describeSegment(e LWODEntry) string {
+	return fmt.Sprintf("[%s-%s] %s | %s | %s", e.Start, e.End, e.Game, e.Subject, e.Topic)
+}
+
+// previewVOD prints what syncing the VOD would change instead of changing it.
+func (r *lwodRun) previewVOD(platform lwodPlatform, id string, entries []LWODEntry, sheet LWODSheet, ws *sheets.Sheet, contents sheetContents) error {
+	old, err := r.storedSegments(platform, id, sheet.ID, ws.Properties.SheetId)
+	if err != nil {
+		return err
+	}
+	old = contents.parsed(old)
+
+	diff := diffSegments(old, entries)
+	if !r.previewed(previewVODKey(platform, id)) {
+		r.preview.vods++
+	}
+	// the VOD is the same one on all the platforms its rows link to
+	for i, p := range lwodPlatforms(r.config, nil, nil, nil, nil, nil) {
+		for _, e := range entries {
+			if vodID := e.vodIDs()[i]; vodID != "" {
+				r.previewed(previewVODKey(p, vodID))
+			}
+		}
+	}
+	for _, e := range diff.Added {
+		if !r.previewed("added " + e.source()) {
+			r.preview.added++
+		}
+	}
+	for _, pair := range diff.Changed {
+		if !r.previewed(fmt.Sprintf("changed %d", pair[0].id)) {
+			r.preview.changed++
+		}
+	}
+	for _, e := range diff.Removed {
+		if !r.previewed(fmt.Sprintf("removed %d", e.id)) {
+			r.preview.removed++
+		}
+	}
+
+	status := "changed"
+	if len(old) == 0 {
+		status = "new"
+	}
+	fmt.Printf("%s %s (%s, spreadsheet %s, worksheet \"%s\"): %d added, %d changed, %d removed\n", platform.Name, id, status, sheet.ID, ws.Properties.Title, len(diff.Added), len(diff.Changed), len(diff.Removed))
+	for _, e := range diff.Added {
+		fmt.Printf("  + %s\n", describeSegment(e))
+	}
+	for _, pair := range diff.Changed {
+		fmt.Printf("  ~ %s\n", describeSegment(pair[1]))
+		for _, change := range changedFields(pair[0], pair[1]) {
+			fmt.Printf("      %s\n", change)
+		}
+	}
+	for _, e := range diff.Removed {
+		fmt.Printf("  - %s\n", describeSegment(e))
+	}
+
+	return nil
+}
+
+// storedSegments reads the segments of a VOD that are currently in the DB
+// (and not removed) and came from the worksheet, or from an unknown one.
+func (r *lwodRun) storedSegments(platform lwodPlatform, id, sheetID string, worksheetID int64) ([]LWODEntry, error) {
+	where := fmt.Sprintf("%s = ? AND removed_at IS NULL AND (sheetid IS NULL OR (sheetid = ? AND worksheetid = ?))", platform.Column)
+	entries, err := r.segments(where, id, sheetID, worksheetID)
+	if err != nil {
+		return nil, WrapWithLWODError(err, fmt.Sprintf("Sqlite error (%s ID %s)", platform.Name, id))
+	}
+	return entries, nil
+}
+
+// segments reads the lwod rows matching the WHERE clause.
+func (r *lwodRun) segments(where string, args ...any) ([]LWODEntry, error) {
+	rows, err := r.config.LWODDBConfig.DB.Query(`SELECT id,
+		coalesce(vodid, ''), coalesce(vidid, ''), coalesce(rumbleid, ''), coalesce(kickid, ''), coalesce(odyseeid, ''),
+		starttime, endtime, yttime, twitchtime, rumbletime, kicktime, odyseetime, game, subject, topic,
+		coalesce((SELECT group_concat(field || char(0) || note, char(1)) FROM lwod_notes WHERE lwodid = lwod.id), ''),
+		coalesce(sheetid, ''), coalesce(worksheetid, 0), coalesce(sheetrow, 0), coalesce(substr(datestreamed, 1, 10), '')
+		FROM lwod WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LWODEntry
+	for rows.Next() {
+		var e LWODEntry
+		var notes, date string
+		err := rows.Scan(&e.id, &e.Twitch, &e.YouTube, &e.Rumble, &e.Kick, &e.Odysee, &e.Start, &e.End, &e.YouTubeStamp, &e.TwitchStamp, &e.RumbleStamp, &e.KickStamp, &e.OdyseeStamp, &e.Game, &e.Subject, &e.Topic, &notes, &e.SheetID, &e.WorksheetID, &e.SheetRow, &date)
+		if err != nil {
+			return nil, err
+		}
+		// only the day is compared, it's the same for all the formats the
+		// driver stores times in
+		if date != "" {
+			e.DateStreamed, _ = time.Parse("2006-01-02", date)
+		}
+		if notes != "" {
+			for _, n := range strings.Split(notes, "\x01") {
+				field, note, _ := strings.Cut(n, "\x00")
+				e.Notes = append(e.Notes, LWODNote{
+					Field: field,
+					Note:  note,
+				})
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
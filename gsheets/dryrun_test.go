@@ -0,0 +1,78 @@
+package gsheets
+
+import (
+	"testing"
+	"time"
+)
+
+func testSegment(row int, start, end, topic string) LWODEntry {
+	return LWODEntry{
+		DateStreamed: time.Date(2023, time.March, 4, 0, 0, 0, 0, time.UTC),
+		YouTube:      "abcdefghijk",
+		Start:        start,
+		End:          end,
+		Topic:        topic,
+		SheetID:      "SHEET1",
+		WorksheetID:  12345,
+		SheetRow:     row,
+	}
+}
+
+func TestDiffSegments(t *testing.T) {
+	tests := []struct {
+		name                    string
+		old, new                []LWODEntry
+		added, changed, removed int
+	}{
+		{
+			name: "unchanged",
+			old:  []LWODEntry{testSegment(1, "0:00", "1:00", "t1")},
+			new:  []LWODEntry{testSegment(1, "0:00", "1:00", "t1")},
+		},
+		{
+			name:    "topic edited",
+			old:     []LWODEntry{testSegment(1, "0:00", "1:00", "t1")},
+			new:     []LWODEntry{testSegment(1, "0:00", "1:00", "t1 edited")},
+			changed: 1,
+		},
+		{
+			name:    "times fixed",
+			old:     []LWODEntry{testSegment(1, "0:00", "1:00", "t1")},
+			new:     []LWODEntry{testSegment(1, "0:05", "1:00", "t1")},
+			changed: 1,
+		},
+		{
+			name: "date fixed",
+			old:  []LWODEntry{testSegment(1, "0:00", "1:00", "t1")},
+			new: func() []LWODEntry {
+				e := testSegment(1, "0:00", "1:00", "t1")
+				e.DateStreamed = time.Date(2023, time.April, 3, 0, 0, 0, 0, time.UTC)
+				return []LWODEntry{e}
+			}(),
+			changed: 1,
+		},
+		{
+			name:  "row inserted above",
+			old:   []LWODEntry{testSegment(1, "1:00", "2:00", "t1")},
+			new:   []LWODEntry{testSegment(1, "0:00", "1:00", "t0"), testSegment(2, "1:00", "2:00", "t1")},
+			added: 1,
+			// the row moved down
+			changed: 1,
+		},
+		{
+			name:    "row deleted",
+			old:     []LWODEntry{testSegment(1, "0:00", "1:00", "t1"), testSegment(2, "1:00", "2:00", "t2")},
+			new:     []LWODEntry{testSegment(1, "0:00", "1:00", "t1")},
+			removed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffSegments(tt.old, tt.new)
+			if len(diff.Added) != tt.added || len(diff.Changed) != tt.changed || len(diff.Removed) != tt.removed {
+				t.Errorf("got %d added, %d changed, %d removed, want %d, %d, %d", len(diff.Added), len(diff.Changed), len(diff.Removed), tt.added, tt.changed, tt.removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package gsheets
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+)
+
+func newGamesCatalog() *catalog {
+	return &catalog{
+		Name:       "game",
+		Table:      "games",
+		AliasTable: "game_aliases",
+		IDColumn:   "gameid",
+	}
+}
+
+const stateGamesHash = "games_hash"
+
+// syncGames seeds the games from LWOD_GAMES, if it's set, and resolves the
+// games of the rows already in the DB again if the aliases changed since they
+// were last resolved. With write set to false it only reads the games.
+func syncGames(config *config.Config, write bool) (*catalog, error) {
+	db := config.LWODDBConfig.DB
+	games := newGamesCatalog()
+
+	if write && config.LWODGames != nil {
+		if err := games.seed(db, config.LWODGames); err != nil {
+			return nil, err
+		}
+	}
+	if err := games.load(db); err != nil {
+		return nil, err
+	}
+	if !write {
+		return games, nil
+	}
+
+	hash := games.hash()
+	var oldHash string
+	err := config.LWODDBConfig.Statements.SelectStateStmt.QueryRow(stateGamesHash).Scan(&oldHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, WrapWithLWODError(err, "Couldn't get the games hash")
+	}
+	if oldHash == hash {
+		return games, nil
+	}
+
+	log.Infof("[LWOD] The game aliases changed, resolving the games again")
+	rows, err := db.Query("SELECT DISTINCT game FROM lwod WHERE game != ''")
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Couldn't get the games in the lwod table")
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, WrapWithLWODError(err, "Couldn't get the games in the lwod table")
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, WrapWithLWODError(err, "Couldn't get the games in the lwod table")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Couldn't begin the Tx")
+	}
+	if err := resolveGames(tx, games, names); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Stmt(config.LWODDBConfig.Statements.UpsertStateStmt).Exec(stateGamesHash, hash); err != nil {
+		tx.Rollback()
+		return nil, WrapWithLWODError(err, "Couldn't save the games hash")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, WrapWithLWODError(err, "Couldn't commit the Tx")
+	}
+
+	return games, nil
+}
+
+// resolveGames points the rows with the game names at the canonical games
+// they're aliases of now.
+func resolveGames(tx *sql.Tx, games *catalog, names []string) error {
+	for _, name := range names {
+		id := games.resolve(name)
+		_, err := tx.Exec("UPDATE lwod SET gameid = ? WHERE game = ? AND gameid IS NOT ?", id, name, id)
+		if err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf(`Couldn't resolve game "%s"`, name))
+		}
+	}
+	return nil
+}
+
+// ListUnresolvedGames prints the game names that aren't aliases of any of
+// the games, along with how many rows have them.
+func ListUnresolvedGames(config *config.Config) error {
+	games, err := syncGames(config, false)
+	if err != nil {
+		return err
+	}
+
+	// resolved here instead of going by gameid, which is only updated by
+	// the next parse
+	rows, err := config.LWODDBConfig.DB.Query("SELECT game, count(*) FROM lwod WHERE removed_at IS NULL AND game != '' GROUP BY game ORDER BY count(*) DESC, game")
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't get the unresolved games")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			return WrapWithLWODError(err, "Couldn't get the unresolved games")
+		}
+		if games.resolve(name).Valid {
+			continue
+		}
+		fmt.Printf("%6d  %s\n", count, name)
+	}
+
+	return rows.Err()
+}
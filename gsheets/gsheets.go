@@ -5,629 +5,605 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/url"
 	"reflect"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/vyneer/lwodcollector/config"
 	log "github.com/vyneer/lwodcollector/logger"
 	"github.com/vyneer/lwodcollector/util"
-	"golang.org/x/exp/maps"
-	"golang.org/x/exp/slices"
+	"google.golang.org/api/sheets/v4"
 )
 
 type LWODSheet struct {
 	ID   string
 	Name string
+	// Folder is the ID of the folder the spreadsheet is in
+	Folder       string
+	ModifiedTime string
+	// Version is the Drive version of the spreadsheet, 0 if it's unknown
+	Version int64
+	// Local is set for local exports, which can't be linked to
+	Local bool
+	// Year and Month are what the spreadsheet is for, 0 if they aren't known
+	Year  int
+	Month time.Month
+}
+
+func newLWODSheet(file SheetFile, folder string, date sheetDate) LWODSheet {
+	return LWODSheet{
+		ID:           file.ID,
+		Name:         file.Name,
+		Folder:       folder,
+		ModifiedTime: file.ModifiedTime,
+		Version:      file.Version,
+		Year:         date.Year,
+		Month:        date.Month,
+	}
 }
 
 type LWODTemplate struct {
-	Date, Start, End, Game, Subject, Topic, VOD int
+	Date, Start, End, Game, Subject, Topic int
+	// every column that can hold VOD links ("VOD", "YouTube VOD", "Twitch" etc.)
+	Links []int
 }
 
 type LWODEntry struct {
 	DateAdded, DateStreamed                                                 time.Time
 	Twitch, YouTube, Rumble, Kick, Odysee, Start, End, Game, Subject, Topic string
 	TwitchStamp, YouTubeStamp, RumbleStamp, KickStamp, OdyseeStamp          int
+	Notes                                                                   []LWODNote
+	// Start and End in seconds and the time between them, null when they're
+	// empty or couldn't be parsed
+	StartSeconds, EndSeconds, Duration sql.NullInt64
+	// TimeFlag says what's wrong with Start and End, if anything
+	TimeFlag string
+	// GameID is the canonical game Game is an alias of, if any
+	GameID sql.NullInt64
+	// SheetID, WorksheetID (the gid) and SheetRow (0-based) say where in the
+	// spreadsheets the entry came from, CellURL links to its topic cell
+	SheetID     string
+	WorksheetID int64
+	SheetRow    int
+	CellURL     string
+	// index of the worksheet row the entry came from
+	row int
+	// id of the lwod row, for the entries read from the DB
+	id int64
 }
 
-type LWODSheetData struct {
-	YouTubeLinks, TwitchLinks, RumbleLinks, KickLinks, OdyseeLinks map[string][]LWODEntry
+// LWODNote is a note attached to one of the cells of an LWOD row, Field being
+// the header of the cell's column.
+type LWODNote struct {
+	Field, Note string
 }
 
+var timestampRegex = regexp.MustCompile(`^(?:(?P<hours>\d+)h)?(?:(?P<minutes>\d+)m)?(?:(?P<seconds>\d+)s?)?$`)
+
 func maxOfTemplate(template LWODTemplate) int64 {
 	tempReflectType := reflect.TypeOf(LWODTemplate{})
 	var max int64 = 0
 
 	for _, v := range reflect.VisibleFields(tempReflectType) {
-		for k := 0; k < tempReflectType.NumField(); k++ {
-			val := reflect.ValueOf(&template).Elem().FieldByName(v.Name).Int()
-			if max < val {
-				max = val
-			}
+		if v.Type.Kind() != reflect.Int {
+			continue
+		}
+		val := reflect.ValueOf(&template).Elem().FieldByName(v.Name).Int()
+		if max < val {
+			max = val
+		}
+	}
+	for _, val := range template.Links {
+		if max < int64(val) {
+			max = int64(val)
 		}
 	}
 
 	return max
 }
 
-func createTemplate(row []string) LWODTemplate {
+// createTemplate matches the header row to the template fields. Each column
+// goes to the field it matches best (see headerScore), and every column that's
+// left over and looks like a link column is added to Links. Fields without a
+// matching column are set to -1.
+func createTemplate(row []string, aliases map[string][]string) LWODTemplate {
 	var template LWODTemplate
-	tempReflectType := reflect.TypeOf(LWODTemplate{})
+	templateValue := reflect.ValueOf(&template).Elem()
 
-	for i, v := range row {
-		lc := strings.ToLower(v)
-		for k := 0; k < tempReflectType.NumField(); k++ {
-			name := strings.ToLower(tempReflectType.Field(k).Name)
-			if strings.Contains(lc, name) {
-				reflect.ValueOf(&template).Elem().FieldByName(tempReflectType.Field(k).Name).SetInt(int64(i))
+	type headerMatch struct {
+		field      string
+		col, score int
+	}
+	var matches []headerMatch
+	for _, field := range templateFields() {
+		templateValue.FieldByName(field).SetInt(-1)
+		for i, v := range row {
+			if score := bestHeaderScore(v, aliases[field]); score >= minHeaderScore {
+				matches = append(matches, headerMatch{field, i, score})
 			}
 		}
 	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	used := make(map[int]bool)
+	for _, m := range matches {
+		if used[m.col] || templateValue.FieldByName(m.field).Int() >= 0 {
+			continue
+		}
+		templateValue.FieldByName(m.field).SetInt(int64(m.col))
+		used[m.col] = true
+	}
+
+	for i, v := range row {
+		if !used[i] && bestHeaderScore(v, aliases["Links"]) >= minHeaderScore {
+			template.Links = append(template.Links, i)
+		}
+	}
 
 	return template
 }
 
-func CollectSheets(config *config.Config) (map[string]LWODSheet, error) {
-	var lwod = make(map[string]LWODSheet, 0)
-
-	resultYears, err := config.GoogleConfig.Drive.Files.List().Q(fmt.Sprintf(`"%s" in parents`, config.LWODFolder)).Fields("files(*)").Do()
-	if err != nil {
-		return nil, WrapWithLWODError(err, "Drive error")
+// CollectSheets finds the spreadsheets to parse in the LWOD folder: the ones
+// of the current, the previous and the upcoming month by default, or the ones
+// asked for with --all, --from/--to or --sheet.
+func CollectSheets(src SheetSource, config *config.Config) (map[string]LWODSheet, error) {
+	if config.Flags.Sheet != "" {
+		return collectSheet(src, config.Flags.Sheet, config)
 	}
 
-	if !config.Flags.AllSheets {
-		today := time.Now()
-		oneMonthAgo := today.AddDate(0, -1, 0)
-		plusSixDays := today.AddDate(0, 0, 6)
-
-		for _, fileYears := range resultYears.Files {
-			if fileYears.MimeType == "application/vnd.google-apps.folder" {
-				switch fileYears.Name {
-				case today.Format("2006"):
-					result, err := config.GoogleConfig.Drive.Files.List().Q(fmt.Sprintf(`"%s" in parents`, fileYears.Id)).Fields("files(*)").Do()
-					if err != nil {
-						return nil, WrapWithLWODError(err, "Drive error")
-					}
-					for _, sheet := range result.Files {
-						if sheet.MimeType == "application/vnd.google-apps.spreadsheet" {
-							key := ""
-							switch sheet.Name[:2] {
-							case today.Format("01"):
-								key = "Today"
-							case oneMonthAgo.Format("01"):
-								key = "OneMonthAgo"
-							case plusSixDays.Format("01"):
-								key = "PlusSixDays"
-							}
-							if key != "" {
-								lwod[key] = LWODSheet{
-									ID:   sheet.Id,
-									Name: sheet.Name,
-								}
-							}
-						}
-					}
-				case oneMonthAgo.Format("2006"):
-					result, err := config.GoogleConfig.Drive.Files.List().Q(fmt.Sprintf(`"%s" in parents`, fileYears.Id)).Fields("files(*)").Do()
-					if err != nil {
-						return nil, WrapWithLWODError(err, "Drive error")
-					}
-					for _, sheet := range result.Files {
-						if sheet.MimeType == "application/vnd.google-apps.spreadsheet" && sheet.Name[:2] == oneMonthAgo.Format("01") {
-							lwod["OneMonthAgo"] = LWODSheet{
-								ID:   sheet.Id,
-								Name: sheet.Name,
-							}
-						}
-					}
-				case plusSixDays.Format("2006"):
-					result, err := config.GoogleConfig.Drive.Files.List().Q(fmt.Sprintf(`"%s" in parents`, fileYears.Id)).Fields("files(*)").Do()
-					if err != nil {
-						return nil, WrapWithLWODError(err, "Drive error")
-					}
-					for _, sheet := range result.Files {
-						if sheet.MimeType == "application/vnd.google-apps.spreadsheet" && sheet.Name[:2] == plusSixDays.Format("01") {
-							lwod["PlusSixDays"] = LWODSheet{
-								ID:   sheet.Id,
-								Name: sheet.Name,
-							}
-						}
-					}
-				}
+	// sheetKey gives the key a spreadsheet gets in the result, or an empty
+	// string if it's not needed
+	var sheetKey func(sheetDate) string
+	var wantYear func(int) bool
+	switch {
+	case config.Flags.From != "" || config.Flags.To != "":
+		from, to, err := monthRange(config.Flags.From, config.Flags.To)
+		if err != nil {
+			return nil, err
+		}
+		sheetKey = func(d sheetDate) string {
+			if d.time().Before(from) || d.time().After(to) {
+				return ""
 			}
+			return d.key()
 		}
-	} else {
-		for _, fileYears := range resultYears.Files {
-			if fileYears.MimeType == "application/vnd.google-apps.folder" {
-				result, err := config.GoogleConfig.Drive.Files.List().Q(fmt.Sprintf(`"%s" in parents`, fileYears.Id)).Fields("files(*)").Do()
-				if err != nil {
-					return nil, WrapWithLWODError(err, "Drive error")
-				}
-				for _, sheet := range result.Files {
-					if sheet.MimeType == "application/vnd.google-apps.spreadsheet" {
-						lwod[fmt.Sprintf(`%s-%s`, fileYears.Name, sheet.Name[:2])] = LWODSheet{
-							ID:   sheet.Id,
-							Name: sheet.Name,
-						}
-					}
+		wantYear = func(year int) bool {
+			return year >= from.Year() && year <= to.Year()
+		}
+	case config.Flags.AllSheets:
+		sheetKey = sheetDate.key
+	default:
+		today := time.Now()
+		sheetKey = func(d sheetDate) string {
+			return windowKey(d, today)
+		}
+		wantYear = func(year int) bool {
+			for _, w := range monthWindow(today) {
+				if w.date.Year() == year {
+					return true
 				}
 			}
+			return false
+		}
+	}
+
+	layout := newSheetLayout(config)
+	folders, err := layout.leafFolders(src, config.LWODFolder, wantYear)
+	if err != nil {
+		return nil, err
+	}
+	found, unrecognized, err := layout.sheetsIn(src, folders)
+	if err != nil {
+		return nil, err
+	}
+	reportUnrecognized(unrecognized)
+
+	var lwod = make(map[string]LWODSheet, 0)
+	for _, sheet := range found {
+		if key := sheetKey(sheet.date); key != "" {
+			lwod[key] = newLWODSheet(sheet.File, sheet.Folder, sheet.date)
 		}
 	}
 
 	return lwod, nil
 }
 
-func ParseSheets(sheets map[string]LWODSheet, config *config.Config) error {
-	numberRegex := regexp.MustCompile(`(\d+)`)
-	youtubeTimeRegex := regexp.MustCompile(`(?P<hours>\d+)h(?P<minutes>\d+)m(?P<seconds>\d+)s|(?P<onlysec>^\d+$)`)
+func ParseSheets(src SheetSource, sheets map[string]LWODSheet, config *config.Config) error {
+	run := newLWODRun(config)
+	err := run.parseSheets(src, sheets)
+	if err == nil {
+		err = run.pruneSnapshots()
+	}
+	run.summarize()
+	return err
+}
+
+// parseSheets fetches the spreadsheets with a pool of LWODWorkers workers,
+// parsing them and writing them to the DB one at a time as they come in.
+func (r *lwodRun) parseSheets(src SheetSource, lwod map[string]LWODSheet) error {
+	type job struct {
+		key   string
+		sheet LWODSheet
+		n     int
+	}
+	type result struct {
+		job
+		file *sheets.Spreadsheet
+		snap *snapshot
+		err  error
+	}
+
+	if !r.dryRun {
+		if err := r.backfillSegmentTimes(); err != nil {
+			return err
+		}
+	}
+	games, err := syncGames(r.config, !r.dryRun)
+	if err != nil {
+		return err
+	}
+	r.games = games
+	subjects, err := syncSubjects(r.config, !r.dryRun)
+	if err != nil {
+		return err
+	}
+	r.subjects = subjects
+
+	keys := make([]string, 0, len(lwod))
+	for key := range lwod {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	y := 0
-	for sheetKey, sheet := range sheets {
-		log.Infof(`[LWOD] Running sheet ID %s (name: "%s", number %d/%d)`, sheet.ID, sheet.Name, y+1, len(sheets))
-		file, err := config.GoogleConfig.Sheets.Spreadsheets.Get(sheet.ID).Fields("spreadsheetId,properties.title,sheets(properties,data.rowData.values(userEnteredValue,effectiveValue,formattedValue,note))").Do()
+	var jobs []job
+	for i, key := range keys {
+		sheet := lwod[key]
+		unchanged, err := r.sheetUnchanged(sheet)
 		if err != nil {
-			return WrapWithLWODError(err, "Sheets error")
+			return err
 		}
-		for k, ws := range file.Sheets {
-			log.Infof(`[LWOD] Running worksheet number %d/%d (name: "%s")`, k+1, len(file.Sheets), ws.Properties.Title)
-			firstRow := getRowValues(ws.Data[0].RowData[0].Values)
-			if slices.Contains(firstRow, "Topic") && slices.Contains(firstRow, "Date") {
-				template := createTemplate(firstRow)
-				maxValueOfTemplate := maxOfTemplate(template)
-				log.Debugf("[LWOD] Created the template for current worksheet: %+v", template)
-
-				entries := make(map[string][]LWODEntry)
-				hashes := make(map[string]string)
-				ytURLs := make(map[string][]LWODEntry)
-				twitchURLs := make(map[string][]LWODEntry)
-				rumbleURLs := make(map[string][]LWODEntry)
-				kickURLs := make(map[string][]LWODEntry)
-				odyseeURLs := make(map[string][]LWODEntry)
-
-				dates := make(map[int]time.Time)
-				var timeBuffer time.Time
-
-				for i, row := range ws.Data[0].RowData {
-					fillWithBlank(&row.Values, maxValueOfTemplate)
-					var youtubeID string
-					var youtubeStamp int
-					var twitchID string
-					// var twitchStamp int
-					var rumbleID string
-					var rumbleStamp int
-					var kickID string
-					// var kickStamp int
-					var odyseeID string
-					var odyseeStamp int
-					v := row.Values
-
-					if strings.Contains(v[template.Date].FormattedValue, "/") {
-						timeBuffer, err = time.Parse("02/01/06", v[template.Date].FormattedValue)
-						if err != nil {
-							timeBuffer, err = time.Parse("01/02/06", v[template.Date].FormattedValue)
-							if err != nil {
-								return WrapWithLWODError(err, "Time parse error")
-							}
-						}
-					}
-					dates[i] = timeBuffer
-					if strings.Contains(v[template.VOD].FormattedValue, "youtu.be") || strings.Contains(v[template.VOD].FormattedValue, "youtube.com") {
-						ytURL, err := url.Parse(strings.TrimSpace(v[template.VOD].FormattedValue))
-						if err != nil {
-							return WrapWithLWODError(err, "URL parse error")
-						}
-						switch ytURL.Host {
-						case "youtu.be":
-							youtubeID = ytURL.Path[1:]
-						case "youtube.com":
-							youtubeID = ytURL.Query().Get("v")
-						default:
-							log.Debugf("[LWOD] No YouTube URL in row: %+v", v[template.VOD].FormattedValue)
-						}
-						matches := youtubeTimeRegex.FindStringSubmatch(ytURL.Query().Get("t"))
-						if len(matches) > 0 {
-							onlySecIndex := youtubeTimeRegex.SubexpIndex("onlysec")
-							hoursIndex := youtubeTimeRegex.SubexpIndex("hours")
-							minutesIndex := youtubeTimeRegex.SubexpIndex("minutes")
-							secondsIndex := youtubeTimeRegex.SubexpIndex("seconds")
-							if matches[onlySecIndex] != "" {
-								youtubeStamp, err = strconv.Atoi(matches[onlySecIndex])
-								if err != nil {
-									return WrapWithLWODError(err, "strconv error")
-								}
-							} else {
-								hours, err := strconv.Atoi(matches[hoursIndex])
-								if err != nil {
-									return WrapWithLWODError(err, "strconv error")
-								}
-								minutes, err := strconv.Atoi(matches[minutesIndex])
-								if err != nil {
-									return WrapWithLWODError(err, "strconv error")
-								}
-								seconds, err := strconv.Atoi(matches[secondsIndex])
-								if err != nil {
-									return WrapWithLWODError(err, "strconv error")
-								}
-								youtubeStamp = (hours * 60 * 60) + (minutes * 60) + seconds
-							}
-						}
-					}
-					if strings.Contains(v[template.VOD].FormattedValue, "twitch.tv/videos") {
-						twitchURL, err := url.Parse(strings.TrimSpace(v[template.VOD].FormattedValue))
-						if err != nil {
-							return WrapWithLWODError(err, "URL parse error")
-						}
-						id := numberRegex.FindString(twitchURL.Path)
-						if id != "" {
-							twitchID = id
-						} else {
-							log.Debugf("[LWOD] No Twitch URL in row: %+v", v[template.VOD].FormattedValue)
-						}
-					}
-					if strings.Contains(v[template.VOD].FormattedValue, "rumble.com/embed") {
-						rumbleURL, err := url.Parse(strings.TrimSpace(v[template.VOD].FormattedValue))
-						if err != nil {
-							return WrapWithLWODError(err, "URL parse error")
-						}
-						id := strings.Split(rumbleURL.Path, "/")[2]
-						if id != "" {
-							rumbleID = id
-							rT := rumbleURL.Query().Get("t")
-							if len(rT) > 0 {
-								rumbleStamp, err = strconv.Atoi(numberRegex.FindString(rT))
-								if err != nil {
-									return WrapWithLWODError(err, "URL parse error")
-								}
-							}
-						} else {
-							log.Debugf("[LWOD] No Rumble URL in row: %+v", v[template.VOD].FormattedValue)
-						}
-					}
-					if strings.Contains(v[template.VOD].FormattedValue, "kick.com/video") {
-						kickURL, err := url.Parse(strings.TrimSpace(v[template.VOD].FormattedValue))
-						if err != nil {
-							return WrapWithLWODError(err, "URL parse error")
-						}
-						id := strings.Split(kickURL.Path, "/")[2]
-						if id != "" {
-							kickID = id
-						} else {
-							log.Debugf("[LWOD] No Kick URL in row: %+v", v[template.VOD].FormattedValue)
-						}
-					}
-					if strings.Contains(v[template.VOD].FormattedValue, "odysee.com") {
-						odyseeURL, err := url.Parse(strings.TrimSpace(v[template.VOD].FormattedValue))
-						if err != nil {
-							return WrapWithLWODError(err, "URL parse error")
-						}
-						id := odyseeURL.Path
-						if id != "" {
-							odyseeID = id
-							oT := odyseeURL.Query().Get("t")
-							if len(oT) > 0 {
-								odyseeStamp, err = strconv.Atoi(numberRegex.FindString(oT))
-								if err != nil {
-									return WrapWithLWODError(err, "URL parse error")
-								}
-							}
-						} else {
-							log.Debugf("[LWOD] No Odysee URL in row: %+v", v[template.VOD].FormattedValue)
-						}
-					}
-					if youtubeID != "" || twitchID != "" || rumbleID != "" || kickID != "" || odyseeID != "" {
-						entry := LWODEntry{
-							DateAdded:    time.Now().UTC(),
-							DateStreamed: dates[i],
-							YouTube:      youtubeID,
-							Twitch:       twitchID,
-							Rumble:       rumbleID,
-							Kick:         kickID,
-							Odysee:       odyseeID,
-							Start:        v[template.Start].FormattedValue,
-							End:          v[template.End].FormattedValue,
-							YouTubeStamp: youtubeStamp,
-							RumbleStamp:  rumbleStamp,
-							OdyseeStamp:  odyseeStamp,
-							Game:         v[template.Game].FormattedValue,
-							Subject:      v[template.Subject].FormattedValue,
-							Topic:        v[template.Topic].FormattedValue,
-						}
-						if youtubeID != "" {
-							ytURLs[youtubeID] = append(ytURLs[youtubeID], entry)
-						}
-						if twitchID != "" {
-							twitchURLs[twitchID] = append(twitchURLs[twitchID], entry)
-						}
-						if rumbleID != "" {
-							rumbleURLs[rumbleID] = append(rumbleURLs[rumbleID], entry)
-						}
-						if kickID != "" {
-							kickURLs[kickID] = append(kickURLs[kickID], entry)
-						}
-						if odyseeID != "" {
-							odyseeURLs[odyseeID] = append(odyseeURLs[odyseeID], entry)
-						}
-					}
+		if unchanged {
+			log.Infof(`[LWOD] Skipping sheet ID %s (name: "%s", number %d/%d), version %d was already parsed`, sheet.ID, sheet.Name, i+1, len(lwod), sheet.Version)
+			continue
+		}
+		jobs = append(jobs, job{key, sheet, i + 1})
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	workers := r.config.LWODWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	jobsCh := make(chan job)
+	results := make(chan result)
+	// closed when the writer stops, so the workers don't get stuck
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(jobsCh)
+		for _, j := range jobs {
+			select {
+			case jobsCh <- j:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobsCh {
+				log.Debugf(`[LWOD] Fetching sheet ID %s (name: "%s")`, j.sheet.ID, j.sheet.Name)
+				file, snap, err := r.fetchSpreadsheet(src, j.sheet)
+				select {
+				case results <- result{j, file, snap, err}:
+				case <-done:
+					return
 				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		if res.err != nil {
+			return res.err
+		}
+		// archived before parsing, so the spreadsheets the parser chokes on
+		// are kept too
+		if res.snap != nil {
+			if err := r.indexSnapshot(res.key, res.sheet, *res.snap); err != nil {
+				return err
+			}
+		}
+		log.Infof(`[LWOD] Running sheet ID %s (name: "%s", number %d/%d)`, res.sheet.ID, res.sheet.Name, res.n, len(lwod))
+		err := r.parseSpreadsheet(res.key, res.sheet, res.file)
+		if err != nil {
+			return err
+		}
+		err = r.sheetParsed(res.sheet)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-				maps.Copy(entries, ytURLs)
-				maps.Copy(entries, twitchURLs)
-				maps.Copy(entries, rumbleURLs)
-				maps.Copy(entries, kickURLs)
-				maps.Copy(entries, odyseeURLs)
+func (r *lwodRun) parseSpreadsheet(sheetKey string, sheet LWODSheet, file *sheets.Spreadsheet) error {
+	config := r.config
+	aliases := headerAliases(config.LWODHeaderAliases)
+	contents := newSheetContents()
+	month := sheetMonth(sheetKey, sheet, newSheetLayout(config))
 
-				for key, dataSlice := range ytURLs {
-					var hashString string
-					var hashOld string
-					for _, value := range dataSlice {
-						hashString += value.YouTube + value.Start + value.End + strconv.Itoa(value.YouTubeStamp) + value.Game + value.Subject + value.Topic
-					}
-					hashNewUint64 := xxhash.Sum64String(hashString)
-					hashNew := strconv.FormatUint(hashNewUint64, 10)
-					err := config.LWODDBConfig.Statements.SelectYTHashStmt.QueryRow(key).Scan(&hashOld)
+	for k, ws := range file.Sheets {
+		log.Infof(`[LWOD] Running worksheet number %d/%d (name: "%s")`, k+1, len(file.Sheets), ws.Properties.Title)
+		if len(ws.Data) == 0 || len(ws.Data[0].RowData) == 0 {
+			log.Debugf(`[LWOD] Worksheet "%s" is empty, skipping`, ws.Properties.Title)
+			continue
+		}
+		template, headerIndex, ok := findTemplate(ws.Data[0].RowData, aliases)
+		if !ok {
+			contents.skipped[ws.Properties.SheetId] = true
+			log.Warnf(`[LWOD] Skipping worksheet "%s" of spreadsheet %s ("%s"), couldn't find a header row with a date, a topic and a VOD column in the first %d rows`, ws.Properties.Title, sheet.ID, sheet.Name, headerSearchRows)
+		} else {
+			headerRow := getRowValues(ws.Data[0].RowData[headerIndex].Values)
+			maxValueOfTemplate := maxOfTemplate(template)
+			log.Debugf("[LWOD] Created the template for current worksheet from row %d: %+v", headerIndex+1, template)
+
+			ytURLs := make(map[string][]LWODEntry)
+			twitchURLs := make(map[string][]LWODEntry)
+			rumbleURLs := make(map[string][]LWODEntry)
+			kickURLs := make(map[string][]LWODEntry)
+			odyseeURLs := make(map[string][]LWODEntry)
+
+			dates := make(map[int]time.Time)
+			var timeBuffer time.Time
+			wsMonth := worksheetMonth(ws.Properties.Title, month)
+
+			for i, row := range ws.Data[0].RowData {
+				if i <= headerIndex {
+					continue
+				}
+				fillWithBlank(&row.Values, maxValueOfTemplate)
+				var youtubeID string
+				var youtubeStamp int
+				var twitchID string
+				var twitchStamp int
+				var rumbleID string
+				var rumbleStamp int
+				var kickID string
+				var kickStamp int
+				var odyseeID string
+				var odyseeStamp int
+				v := row.Values
+
+				sheetRow := int(ws.Data[0].StartRow) + i
+				parsed, ok, err := streamDate(v[template.Date], wsMonth)
+				if err != nil {
+					err = r.rowError(sheet.ID, ws.Properties.Title, i, template.Date, cellValue(v, template.Date), err, "Time parse error")
 					if err != nil {
-						switch {
-						case errors.Is(err, sql.ErrNoRows):
-							log.Debugf("[LWOD] Couldn't find a row with YouTube ID %s, adding it to the DB.", key)
-						default:
-							return WrapWithLWODError(err, fmt.Sprintf("Sqlite error (YouTube ID %s)", key))
-						}
-					}
-					if hashOld != hashNew {
-						if hashOld != "" {
-							log.Debugf("[LWOD] For YouTube ID %s, the old hash (%s...) doesn't equal the new hash (%s...), proceeding", key, hashOld[8:], hashNew[8:])
-						}
-						_, err := config.LWODDBConfig.Statements.DeleteYTStmt.Exec(key)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete entries with YouTube ID %s", key))
-						}
-						_, err = config.LWODDBConfig.Statements.InsertYTStmt.Exec(key, hashNew)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry with YouTube ID %s", key))
-						}
-						hashes[key] = hashNew
-						if k > 0 && sheetKey == "Today" {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", time.Now().Format("2006-01")), sheet.ID)
-							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with YouTube ID %s", key))
-							}
-						} else if config.Flags.AllSheets {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", sheetKey), sheet.ID)
-							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with YouTube ID %s", key))
-							}
-						}
+						return err
 					}
+					contents.fail(ws.Properties.SheetId, sheetRow)
+					continue
 				}
-				for key, dataSlice := range twitchURLs {
-					var hashString string
-					var hashOld string
-					for _, value := range dataSlice {
-						hashString += value.Twitch + value.YouTube + value.Rumble + value.Kick + value.Odysee + value.Start + value.End + strconv.Itoa(value.YouTubeStamp) + strconv.Itoa(value.TwitchStamp) + strconv.Itoa(value.RumbleStamp) + strconv.Itoa(value.KickStamp) + strconv.Itoa(value.OdyseeStamp) + value.Game + value.Subject + value.Topic
-					}
-					hashNewUint64 := xxhash.Sum64String(hashString)
-					hashNew := strconv.FormatUint(hashNewUint64, 10)
-					err := config.LWODDBConfig.Statements.SelectTwitchHashStmt.QueryRow(key).Scan(&hashOld)
-					if err != nil {
-						switch {
-						case errors.Is(err, sql.ErrNoRows):
-							log.Debugf("[LWOD] Couldn't find a row with Twitch ID %s, adding it to the DB", key)
-						default:
-							return WrapWithLWODError(err, fmt.Sprintf("Sqlite error (Twitch ID %s)", key))
-						}
+				if ok {
+					if wsMonth.Month != 0 && !wsMonth.contains(parsed) && !parsed.Equal(timeBuffer) {
+						log.Warnf(`[LWOD] Date "%s" in row %d of worksheet "%s" of spreadsheet %s ("%s") is outside of the sheet's month (%s), read it as %s`, cellValue(v, template.Date), i+1, ws.Properties.Title, sheet.ID, sheet.Name, wsMonth, parsed.Format("2006-01-02"))
 					}
-					if hashOld != hashNew {
-						if hashOld != "" {
-							log.Debugf("[LWOD] For Twitch ID %s, the old hash (%s...) doesn't equal the new hash (%s...), proceeding", key, hashOld[8:], hashNew[8:])
-						}
-						_, err := config.LWODDBConfig.Statements.DeleteTwitchStmt.Exec(key)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete entries with Twitch ID %s", key))
-						}
-						_, err = config.LWODDBConfig.Statements.InsertTwitchStmt.Exec(key, hashNew)
+					timeBuffer = parsed
+				}
+				dates[i] = timeBuffer
+				for _, col := range template.Links {
+					// a single cell can have several links separated by newlines or spaces
+					for _, raw := range cellLinks(v[col]) {
+						link, ok, err := ExtractLink(raw)
 						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry with Twitch ID %s", key))
-						}
-						hashes[key] = hashNew
-						if k > 0 && sheetKey == "Today" {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", time.Now().Format("2006-01")), sheet.ID)
+							err = r.rowError(sheet.ID, ws.Properties.Title, i, col, raw, err, "URL parse error")
 							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Twitch ID %s", key))
+								return err
 							}
-						} else if config.Flags.AllSheets {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", sheetKey), sheet.ID)
-							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Twitch ID %s", key))
+							contents.fail(ws.Properties.SheetId, sheetRow)
+							continue
+						}
+						if !ok {
+							if strings.Contains(raw, "/") {
+								log.Debugf("[LWOD] No VOD URL in row: %+v", raw)
 							}
+							continue
+						}
+						var id *string
+						var stamp *int
+						switch link.Platform {
+						case PlatformYouTube:
+							id, stamp = &youtubeID, &youtubeStamp
+						case PlatformTwitch:
+							id, stamp = &twitchID, &twitchStamp
+						case PlatformRumble:
+							id, stamp = &rumbleID, &rumbleStamp
+						case PlatformKick:
+							id, stamp = &kickID, &kickStamp
+						case PlatformOdysee:
+							id, stamp = &odyseeID, &odyseeStamp
+						default:
+							continue
+						}
+						if *id != "" {
+							log.Debugf("[LWOD] Row already has a %s link (%s), ignoring %s", link.Platform, *id, raw)
+							continue
 						}
+						*id, *stamp = link.ID, link.Offset
 					}
 				}
-				for key, dataSlice := range rumbleURLs {
-					var hashString string
-					var hashOld string
-					for _, value := range dataSlice {
-						hashString += value.Twitch + value.YouTube + value.Rumble + value.Kick + value.Odysee + value.Start + value.End + strconv.Itoa(value.YouTubeStamp) + strconv.Itoa(value.TwitchStamp) + strconv.Itoa(value.RumbleStamp) + strconv.Itoa(value.KickStamp) + strconv.Itoa(value.OdyseeStamp) + value.Game + value.Subject + value.Topic
+				// what's stored for a row with a broken link is kept until
+				// it's fixed, rather than losing the link
+				if contents.failed[ws.Properties.SheetId][sheetRow] {
+					continue
+				}
+				if youtubeID != "" || twitchID != "" || rumbleID != "" || kickID != "" || odyseeID != "" {
+					var notes []LWODNote
+					for c, cell := range v {
+						if strings.TrimSpace(cell.Note) == "" {
+							continue
+						}
+						field := ""
+						if c < len(headerRow) {
+							field = headerRow[c]
+						}
+						notes = append(notes, LWODNote{
+							Field: field,
+							Note:  strings.TrimSpace(cell.Note),
+						})
 					}
-					hashNewUint64 := xxhash.Sum64String(hashString)
-					hashNew := strconv.FormatUint(hashNewUint64, 10)
-					err := config.LWODDBConfig.Statements.SelectRumbleHashStmt.QueryRow(key).Scan(&hashOld)
-					if err != nil {
-						switch {
-						case errors.Is(err, sql.ErrNoRows):
-							log.Debugf("[LWOD] Couldn't find a row with Rumble ID %s, adding it to the DB", key)
-						default:
-							return WrapWithLWODError(err, fmt.Sprintf("Sqlite error (Rumble ID %s)", key))
-						}
+					entry := LWODEntry{
+						DateAdded:    time.Now().UTC(),
+						DateStreamed: dates[i],
+						YouTube:      youtubeID,
+						Twitch:       twitchID,
+						Rumble:       rumbleID,
+						Kick:         kickID,
+						Odysee:       odyseeID,
+						Start:        cellValue(v, template.Start),
+						End:          cellValue(v, template.End),
+						YouTubeStamp: youtubeStamp,
+						TwitchStamp:  twitchStamp,
+						RumbleStamp:  rumbleStamp,
+						KickStamp:    kickStamp,
+						OdyseeStamp:  odyseeStamp,
+						Game:         cellValue(v, template.Game),
+						Subject:      cellValue(v, template.Subject),
+						Topic:        cellValue(v, template.Topic),
+						Notes:        notes,
+						SheetID:      sheet.ID,
+						WorksheetID:  ws.Properties.SheetId,
+						SheetRow:     sheetRow,
+						row:          i,
 					}
-					if hashOld != hashNew {
-						if hashOld != "" {
-							log.Debugf("[LWOD] For Rumble ID %s, the old hash (%s...) doesn't equal the new hash (%s...), proceeding", key, hashOld[8:], hashNew[8:])
-						}
-						_, err := config.LWODDBConfig.Statements.DeleteRumbleStmt.Exec(key)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete entries with Rumble ID %s", key))
-						}
-						_, err = config.LWODDBConfig.Statements.InsertRumbleStmt.Exec(key, hashNew)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry with Rumble ID %s", key))
-						}
-						hashes[key] = hashNew
-						if k > 0 && sheetKey == "Today" {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", time.Now().Format("2006-01")), sheet.ID)
-							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Rumble ID %s", key))
-							}
-						} else if config.Flags.AllSheets {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", sheetKey), sheet.ID)
-							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Rumble ID %s", key))
-							}
-						}
+					if !sheet.Local {
+						entry.CellURL = cellURL(sheet.ID, entry.WorksheetID, entry.SheetRow, template.Topic)
 					}
-				}
-				for key, dataSlice := range kickURLs {
-					var hashString string
-					var hashOld string
-					for _, value := range dataSlice {
-						hashString += value.Twitch + value.YouTube + value.Rumble + value.Kick + value.Odysee + value.Start + value.End + strconv.Itoa(value.YouTubeStamp) + strconv.Itoa(value.TwitchStamp) + strconv.Itoa(value.RumbleStamp) + strconv.Itoa(value.KickStamp) + strconv.Itoa(value.OdyseeStamp) + value.Game + value.Subject + value.Topic
+					r.parseSegmentTimes(&entry, sheet.ID, ws.Properties.Title)
+					entry.GameID = r.resolveGame(entry.Game)
+					if youtubeID != "" {
+						ytURLs[youtubeID] = append(ytURLs[youtubeID], entry)
 					}
-					hashNewUint64 := xxhash.Sum64String(hashString)
-					hashNew := strconv.FormatUint(hashNewUint64, 10)
-					err := config.LWODDBConfig.Statements.SelectKickHashStmt.QueryRow(key).Scan(&hashOld)
-					if err != nil {
-						switch {
-						case errors.Is(err, sql.ErrNoRows):
-							log.Debugf("[LWOD] Couldn't find a row with Kick ID %s, adding it to the DB", key)
-						default:
-							return WrapWithLWODError(err, fmt.Sprintf("Sqlite error (Kick ID %s)", key))
-						}
+					if twitchID != "" {
+						twitchURLs[twitchID] = append(twitchURLs[twitchID], entry)
 					}
-					if hashOld != hashNew {
-						if hashOld != "" {
-							log.Debugf("[LWOD] For Kick ID %s, the old hash (%s...) doesn't equal the new hash (%s...), proceeding", key, hashOld[8:], hashNew[8:])
-						}
-						_, err := config.LWODDBConfig.Statements.DeleteKickStmt.Exec(key)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete entries with Kick ID %s", key))
-						}
-						_, err = config.LWODDBConfig.Statements.InsertKickStmt.Exec(key, hashNew)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry with Kick ID %s", key))
-						}
-						hashes[key] = hashNew
-						if k > 0 && sheetKey == "Today" {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", time.Now().Format("2006-01")), sheet.ID)
-							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Kick ID %s", key))
-							}
-						} else if config.Flags.AllSheets {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", sheetKey), sheet.ID)
-							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Kick ID %s", key))
-							}
-						}
+					if rumbleID != "" {
+						rumbleURLs[rumbleID] = append(rumbleURLs[rumbleID], entry)
+					}
+					if kickID != "" {
+						kickURLs[kickID] = append(kickURLs[kickID], entry)
+					}
+					if odyseeID != "" {
+						odyseeURLs[odyseeID] = append(odyseeURLs[odyseeID], entry)
 					}
 				}
-				for key, dataSlice := range odyseeURLs {
-					var hashString string
+			}
+
+			var changed []changedVOD
+			for _, platform := range lwodPlatforms(config, ytURLs, twitchURLs, rumbleURLs, kickURLs, odyseeURLs) {
+				for key, dataSlice := range platform.URLs {
+					contents.add(ws.Properties.SheetId, platform, key)
 					var hashOld string
-					for _, value := range dataSlice {
-						hashString += value.Twitch + value.YouTube + value.Rumble + value.Kick + value.Odysee + value.Start + value.End + strconv.Itoa(value.YouTubeStamp) + strconv.Itoa(value.TwitchStamp) + strconv.Itoa(value.RumbleStamp) + strconv.Itoa(value.KickStamp) + strconv.Itoa(value.OdyseeStamp) + value.Game + value.Subject + value.Topic
-					}
-					hashNewUint64 := xxhash.Sum64String(hashString)
-					hashNew := strconv.FormatUint(hashNewUint64, 10)
-					err := config.LWODDBConfig.Statements.SelectOdyseeHashStmt.QueryRow(key).Scan(&hashOld)
+					hashNew := platform.hash(dataSlice)
+					err := platform.selectHash.QueryRow(key).Scan(&hashOld)
 					if err != nil {
 						switch {
 						case errors.Is(err, sql.ErrNoRows):
-							log.Debugf("[LWOD] Couldn't find a row with Odysee ID %s, adding it to the DB", key)
+							log.Debugf("[LWOD] Couldn't find a row with %s ID %s, adding it to the DB", platform.Name, key)
 						default:
-							return WrapWithLWODError(err, fmt.Sprintf("Sqlite error (Odysee ID %s)", key))
+							return WrapWithLWODError(err, fmt.Sprintf("Sqlite error (%s ID %s)", platform.Name, key))
 						}
 					}
 					if hashOld != hashNew {
-						if hashOld != "" {
-							log.Debugf("[LWOD] For Odysee ID %s, the old hash (%s...) doesn't equal the new hash (%s...), proceeding", key, hashOld[8:], hashNew[8:])
-						}
-						_, err := config.LWODDBConfig.Statements.DeleteOdyseeStmt.Exec(key)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete entries with Odysee ID %s", key))
+						if hashOutdated(hashOld) {
+							r.rehashed++
 						}
-						_, err = config.LWODDBConfig.Statements.InsertOdyseeStmt.Exec(key, hashNew)
-						if err != nil {
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry with Odysee ID %s", key))
+						if hashOld != "" {
+							log.Debugf("[LWOD] For %s ID %s, the old hash (%s...) doesn't equal the new hash (%s...), proceeding", platform.Name, key, hashOld[8:], hashNew[8:])
 						}
-						hashes[key] = hashNew
+						if r.dryRun {
+							err := r.previewVOD(platform, key, dataSlice, sheet, ws, contents)
+							if err != nil {
+								return err
+							}
+							continue
+						}
+						changed = append(changed, changedVOD{
+							platform: platform,
+							id:       key,
+							hash:     hashNew,
+							entries:  dataSlice,
+						})
 						if k > 0 && sheetKey == "Today" {
-							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", time.Now().Format("2006-01")), sheet.ID)
+							// the month the sheet was collected for, which
+							// isn't the current one when replaying old runs
+							date := time.Now()
+							if sheet.Month != 0 {
+								date = sheetDate{sheet.Year, sheet.Month}.time()
+							}
+							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", date.Format("2006-01")), sheet.ID)
 							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Odysee ID %s", key))
+								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with %s ID %s", platform.Name, key))
 							}
-						} else if config.Flags.AllSheets {
+						} else if isMonthKey(sheetKey) {
 							_, err = config.LWODDBConfig.Statements.InsertURLStmt.Exec(fmt.Sprintf("%s-01", sheetKey), sheet.ID)
 							if err != nil {
-								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with Odysee ID %s", key))
+								return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into lwodUrl with %s ID %s", platform.Name, key))
 							}
 						}
 					}
 				}
+			}
 
-				dedupedEntries := dedupHashes(hashes, entries)
-				log.Debugf("[LWOD] Deduped entries: %d", len(dedupedEntries))
-				for _, value := range dedupedEntries {
-					tx, err := config.LWODDBConfig.DB.Begin()
-					if err != nil {
-						return WrapWithLWODError(err, fmt.Sprintf(`Couldn't begin the Tx (spreadsheet %s: "%s", worksheet %d: "%s")`, sheet.ID, sheet.Name, k+1, ws.Properties.Title))
-					}
-					for _, entry := range value {
-						_, err = tx.Exec(
-							"INSERT INTO lwod (dateadded, datestreamed, vodid, vidid, rumbleid, kickid, odyseeid, starttime, endtime, yttime, twitchtime, rumbletime, kicktime, odyseetime, game, subject, topic) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-							entry.DateAdded,
-							entry.DateStreamed,
-							newNullString(entry.Twitch),
-							newNullString(entry.YouTube),
-							newNullString(entry.Rumble),
-							newNullString(entry.Kick),
-							newNullString(entry.Odysee),
-							entry.Start,
-							entry.End,
-							entry.YouTubeStamp,
-							entry.TwitchStamp,
-							entry.RumbleStamp,
-							entry.KickStamp,
-							entry.OdyseeStamp,
-							entry.Game,
-							entry.Subject,
-							entry.Topic,
-						)
-						if err != nil {
-							tx.Rollback()
-							return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry %+v", entry))
-						}
-					}
-					tx.Commit()
+			if len(changed) > 0 {
+				err := r.syncVODs(changed, sheet, ws, contents)
+				if err != nil {
+					return err
 				}
 			}
-			if k != len(file.Sheets)-1 {
-				time.Sleep(time.Second * time.Duration(config.LWODDelay))
-			}
 		}
-		if y != len(sheets)-1 {
-			time.Sleep(time.Second * time.Duration(config.LWODDelay))
-		}
-		y++
 	}
-	return nil
+	return r.reconcile(sheet, contents)
 }
 
 func SheetsLoop(cfg *config.Config) error {
-	sheets, err := CollectSheets(cfg)
+	return SheetsLoopWithSource(NewRateLimitedSource(NewDriveSource(cfg), cfg), cfg)
+}
+
+// SheetsLoopWithSource is SheetsLoop with the spreadsheets coming from src
+// instead of Google Drive.
+func SheetsLoopWithSource(src SheetSource, cfg *config.Config) error {
+	var sheets map[string]LWODSheet
+	var pageToken string
+	var scanned bool
+	var err error
+	targeted := cfg.Flags.AllSheets || cfg.Flags.From != "" || cfg.Flags.To != "" || cfg.Flags.Sheet != ""
+	if changes, ok := src.(ChangeSource); ok && !targeted {
+		sheets, pageToken, scanned, err = CollectChangedSheets(changes, cfg)
+	} else {
+		sheets, err = CollectSheets(src, cfg)
+	}
 	if err != nil {
 		return err
 	}
@@ -643,10 +619,14 @@ func SheetsLoop(cfg *config.Config) error {
 	} else {
 		log.Infof("[LWOD] Grabbed the sheets from the folder: %+v", sheets)
 	}
-	err = ParseSheets(sheets, cfg)
-	if err != nil {
+	if err := ParseSheets(src, sheets, cfg); err != nil {
 		return err
 	}
+	if pageToken != "" && !cfg.Flags.DryRun {
+		if err := SavePageToken(pageToken, scanned, cfg); err != nil {
+			return err
+		}
+	}
 	if cfg.LWODHealthCheck != "" && cfg.Continuous {
 		util.HealthCheck(&cfg.LWODHealthCheck)
 	}
@@ -0,0 +1,261 @@
+package gsheets
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/vyneer/lwodcollector/config"
+	"google.golang.org/api/sheets/v4"
+)
+
+// testConfig loads fresh DBs in a temporary directory.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	cfg := &config.Config{
+		LWODDBFile: "lwod.db",
+		YTDBFile:   "yt.db",
+		LWODFolder: "root",
+	}
+	config.LoadDatabase(cfg)
+	t.Cleanup(func() {
+		cfg.LWODDBConfig.DB.Close()
+		cfg.YTDBConfig.DB.Close()
+	})
+	return cfg
+}
+
+func testSpreadsheet(id string, rows ...[]string) *sheets.Spreadsheet {
+	var data []*sheets.RowData
+	for _, values := range rows {
+		row := &sheets.RowData{}
+		for _, v := range values {
+			row.Values = append(row.Values, &sheets.CellData{FormattedValue: v})
+		}
+		data = append(data, row)
+	}
+	return &sheets.Spreadsheet{
+		SpreadsheetId: id,
+		Sheets: []*sheets.Sheet{{
+			Properties: &sheets.SheetProperties{SheetId: 12345, Title: "Sheet1"},
+			Data:       []*sheets.GridData{{RowData: data}},
+		}},
+	}
+}
+
+func TestParseSheetsMemorySource(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Flags.AllSheets = true
+
+	src := NewMemorySource()
+	src.AddFolder("root", "folder2023", "2023")
+	src.AddSpreadsheet("folder2023", "03 March", testSpreadsheet("SHEET1",
+		[]string{"Date", "Start", "End", "Game", "Subject", "Topic", "VOD"},
+		[]string{"15/03/23", "0:00", "1:00", "Chess", "Destiny", "first", "https://youtu.be/dQw4w9WgXcQ?t=10"},
+		[]string{"", "1:00", "2:00", "Chess", "Destiny", "second", "https://www.twitch.tv/videos/1234567890"},
+	))
+
+	lwod, err := CollectSheets(src, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lwod) != 1 {
+		t.Fatalf("CollectSheets found %+v, want just the March sheet", lwod)
+	}
+	if err := ParseSheets(src, lwod, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := cfg.LWODDBConfig.DB.Query("SELECT substr(datestreamed, 1, 10), coalesce(vidid, ''), coalesce(vodid, ''), topic FROM lwod ORDER BY topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type row struct {
+		date, youtube, twitch, topic string
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.date, &r.youtube, &r.twitch, &r.topic); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := []row{
+		{"2023-03-15", "dQw4w9WgXcQ", "", "first"},
+		{"2023-03-15", "", "1234567890", "second"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got rows %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+var testHeader = []string{"Date", "Start", "End", "Game", "Subject", "Topic", "YouTube", "Twitch"}
+
+func TestParseSheetsTimesEdit(t *testing.T) {
+	cfg := testConfig(t)
+	lwod := map[string]LWODSheet{"2023-03": {ID: "SHEET1", Name: "2023-03", Year: 2023, Month: 3}}
+
+	for _, start := range []string{"0:00", "0:05"} {
+		src := NewMemorySource()
+		src.AddSpreadsheet("root", "2023-03", testSpreadsheet("SHEET1", testHeader,
+			[]string{"04/03/23", start, "1:00", "Chess", "Destiny", "first", "https://youtu.be/dQw4w9WgXcQ?t=10", ""},
+		))
+		if err := ParseSheets(src, lwod, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := cfg.LWODDBConfig.DB
+	var id int64
+	var start string
+	if err := db.QueryRow("SELECT id, starttime FROM lwod WHERE removed_at IS NULL").Scan(&id, &start); err != nil {
+		t.Fatal(err)
+	}
+	if start != "0:05" {
+		t.Errorf("the start is %q, want the fixed 0:05", start)
+	}
+	var updates int
+	if err := db.QueryRow("SELECT count(*) FROM lwod_history WHERE lwodid = ? AND action = 'update'", id).Scan(&updates); err != nil {
+		t.Fatal(err)
+	}
+	if updates != 1 {
+		t.Errorf("got %d updates in lwod_history, want 1", updates)
+	}
+}
+
+func TestParseSheetsDryRun(t *testing.T) {
+	cfg := testConfig(t)
+	lwod := map[string]LWODSheet{"2023-03": {ID: "SHEET1", Name: "2023-03", Year: 2023, Month: 3}}
+	sheet := func(topic string) *MemorySource {
+		src := NewMemorySource()
+		src.AddSpreadsheet("root", "2023-03", testSpreadsheet("SHEET1", testHeader,
+			[]string{"04/03/23", "0:00", "1:00", "Chess", "Destiny", topic, "https://youtu.be/dQw4w9WgXcQ?t=10", "https://www.twitch.tv/videos/1234567890"},
+			[]string{"", "1:00", "2:00", "Chess", "Destiny", "second", "https://youtu.be/dQw4w9WgXcQ?t=70", "https://www.twitch.tv/videos/1234567890"},
+		))
+		return src
+	}
+	if err := ParseSheets(sheet("first"), lwod, cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LWODDBConfig.DB.Close()
+	cfg.YTDBConfig.DB.Close()
+	before, err := os.ReadFile("db/lwod.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Flags.DryRun = true
+	config.LoadDatabase(cfg)
+	run := newLWODRun(cfg)
+	if err := run.parseSheets(sheet("first edited"), lwod); err != nil {
+		t.Fatal(err)
+	}
+	// the YouTube and the Twitch VOD are the same one
+	if run.preview.vods != 1 || run.preview.added != 0 || run.preview.changed != 1 || run.preview.removed != 0 {
+		t.Errorf("previewed %d VOD(s), %d added, %d changed, %d removed, want 1, 0, 1, 0", run.preview.vods, run.preview.added, run.preview.changed, run.preview.removed)
+	}
+
+	after, err := os.ReadFile("db/lwod.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("the dry run changed the DB")
+	}
+}
+
+func TestParseSheetsLenientKeepsStoredRows(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Flags.Lenient = true
+	lwod := map[string]LWODSheet{"2023-03": {ID: "SHEET1", Name: "2023-03", Year: 2023, Month: 3}}
+
+	for _, rows := range [][][]string{
+		{
+			{"04/03/23", "0:00", "1:00", "Chess", "Destiny", "first", "https://youtu.be/dQw4w9WgXcQ?t=10", ""},
+			{"05/03/23", "0:00", "1:00", "Chess", "Destiny", "second", "https://youtu.be/aaaaaaaaaaa", "https://www.twitch.tv/videos/1234567890"},
+		},
+		// a typo in the date of the first row and in a link of the second
+		{
+			{"40/40/23", "0:00", "1:00", "Chess", "Destiny", "first", "https://youtu.be/dQw4w9WgXcQ?t=10", ""},
+			{"05/03/23", "0:00", "1:00", "Chess", "Destiny", "second", "https://youtu.be/%zz", "https://www.twitch.tv/videos/1234567890"},
+		},
+	} {
+		src := NewMemorySource()
+		src.AddSpreadsheet("root", "2023-03", testSpreadsheet("SHEET1", append([][]string{testHeader}, rows...)...))
+		if err := ParseSheets(src, lwod, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := cfg.LWODDBConfig.DB
+	var segments, vods, parseErrors int
+	if err := db.QueryRow("SELECT count(*) FROM lwod WHERE removed_at IS NULL AND vidid IN ('dQw4w9WgXcQ', 'aaaaaaaaaaa')").Scan(&segments); err != nil {
+		t.Fatal(err)
+	}
+	if segments != 2 {
+		t.Errorf("%d of the 2 segments are left", segments)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM youtube WHERE removed_at IS NULL").Scan(&vods); err != nil {
+		t.Fatal(err)
+	}
+	if vods != 2 {
+		t.Errorf("%d of the 2 YouTube VODs are left", vods)
+	}
+	if err := db.QueryRow("SELECT count(*) FROM parse_errors").Scan(&parseErrors); err != nil {
+		t.Fatal(err)
+	}
+	if parseErrors != 2 {
+		t.Errorf("got %d parse errors, want 2", parseErrors)
+	}
+}
+
+func TestParseSheetsGameAliases(t *testing.T) {
+	cfg := testConfig(t)
+	lwod := map[string]LWODSheet{"2023-03": {ID: "SHEET1", Name: "2023-03", Year: 2023, Month: 3}}
+	spreadsheet := testSpreadsheet("SHEET1",
+		testHeader,
+		[]string{"04/03/23", "0:00", "1:00", "LoL", "Destiny", "first", "https://youtu.be/dQw4w9WgXcQ?t=10", ""},
+		[]string{"05/03/23", "0:00", "1:00", "Chess", "Destiny", "second", "https://youtu.be/aaaaaaaaaaa", ""},
+	)
+
+	resolved := func() int {
+		t.Helper()
+		var n int
+		if err := cfg.LWODDBConfig.DB.QueryRow("SELECT count(*) FROM lwod WHERE gameid IS NOT NULL").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// the second parse doesn't change any VODs, only the aliases
+	for i, games := range []map[string][]string{nil, {"League of Legends": {"lol"}}} {
+		cfg.LWODGames = games
+		src := NewMemorySource()
+		src.AddSpreadsheet("root", "2023-03", spreadsheet)
+		if err := ParseSheets(src, lwod, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := resolved(), i; got != want {
+			t.Errorf("parse %d: %d row(s) have a gameid, want %d", i+1, got, want)
+		}
+	}
+}
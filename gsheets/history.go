@@ -0,0 +1,166 @@
+package gsheets
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+)
+
+// the values of the action column of lwod_history
+const (
+	historyInsert = "insert"
+	historyUpdate = "update"
+	historyRemove = "remove"
+)
+
+// historyFields lists everything about a segment that's recorded in
+// lwod_history, which is also what a dry run compares.
+func historyFields(e LWODEntry) []segmentField {
+	return []segmentField{
+		{"start", e.Start},
+		{"end", e.End},
+		{"datestreamed", e.DateStreamed.Format("2006-01-02")},
+		{"youtube", e.YouTube},
+		{"twitch", e.Twitch},
+		{"rumble", e.Rumble},
+		{"kick", e.Kick},
+		{"odysee", e.Odysee},
+		{"yttime", strconv.Itoa(e.YouTubeStamp)},
+		{"twitchtime", strconv.Itoa(e.TwitchStamp)},
+		{"rumbletime", strconv.Itoa(e.RumbleStamp)},
+		{"kicktime", strconv.Itoa(e.KickStamp)},
+		{"odyseetime", strconv.Itoa(e.OdyseeStamp)},
+		{"game", e.Game},
+		{"subject", e.Subject},
+		{"topic", e.Topic},
+		{"notes", notesSummary(e.Notes)},
+		{"source", e.source()},
+	}
+}
+
+// recordHistory adds a row to lwod_history. Inserts only have the new
+// values and removals the old ones, while updates have the old and the new
+// values of just the fields that changed.
+func (r *lwodRun) recordHistory(tx *sql.Tx, lwodID int64, action string, old, new *LWODEntry) error {
+	var oldValues, newValues map[string]string
+	switch {
+	case old != nil && new != nil:
+		oldValues, newValues = make(map[string]string), make(map[string]string)
+		oldFields, newFields := historyFields(*old), historyFields(*new)
+		for i := range oldFields {
+			if oldFields[i].Value != newFields[i].Value {
+				oldValues[oldFields[i].Name] = oldFields[i].Value
+				newValues[newFields[i].Name] = newFields[i].Value
+			}
+		}
+	case old != nil:
+		oldValues = fieldValues(historyFields(*old))
+	case new != nil:
+		newValues = fieldValues(historyFields(*new))
+	}
+
+	oldJSON, err := historyJSON(oldValues)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't encode the history of entry %d", lwodID))
+	}
+	newJSON, err := historyJSON(newValues)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't encode the history of entry %d", lwodID))
+	}
+	_, err = tx.Stmt(r.config.LWODDBConfig.Statements.InsertHistoryStmt).Exec(r.runID, time.Now().UTC(), lwodID, action, oldJSON, newJSON)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert the history of entry %d", lwodID))
+	}
+
+	return nil
+}
+
+func fieldValues(fields []segmentField) map[string]string {
+	values := make(map[string]string)
+	for _, f := range fields {
+		values[f.Name] = f.Value
+	}
+	return values
+}
+
+func historyJSON(values map[string]string) (sql.NullString, error) {
+	if values == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// PrintHistory prints the edit timeline of the segments of a VOD, including
+// the ones that were moved to another VOD or removed.
+func PrintHistory(config *config.Config, vod string) error {
+	rows, err := config.LWODDBConfig.DB.Query(`SELECT time, runid, lwodid, action, coalesce(old, ''), coalesce(new, '') FROM lwod_history
+		WHERE lwodid IN (SELECT id FROM lwod WHERE ?1 IN (vidid, vodid, rumbleid, kickid, odyseeid))
+		OR lwodid IN (SELECT h.lwodid FROM lwod_history h, json_each(h.old) j WHERE j.key IN ('youtube', 'twitch', 'rumble', 'kick', 'odysee') AND j.value = ?1)
+		OR lwodid IN (SELECT h.lwodid FROM lwod_history h, json_each(h.new) j WHERE j.key IN ('youtube', 'twitch', 'rumble', 'kick', 'odysee') AND j.value = ?1)
+		ORDER BY id`, vod)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the history of VOD %s", vod))
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var t, runID, action, oldJSON, newJSON string
+		var lwodID int64
+		if err := rows.Scan(&t, &runID, &lwodID, &action, &oldJSON, &newJSON); err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the history of VOD %s", vod))
+		}
+		var old, new map[string]string
+		if oldJSON != "" {
+			if err := json.Unmarshal([]byte(oldJSON), &old); err != nil {
+				return WrapWithLWODError(err, fmt.Sprintf("Couldn't decode the history of entry %d", lwodID))
+			}
+		}
+		if newJSON != "" {
+			if err := json.Unmarshal([]byte(newJSON), &new); err != nil {
+				return WrapWithLWODError(err, fmt.Sprintf("Couldn't decode the history of entry %d", lwodID))
+			}
+		}
+
+		n++
+		fmt.Printf("%s  %-6s  segment %d  (run %s)\n", t, action, lwodID, runID)
+		switch action {
+		case historyUpdate:
+			names := make([]string, 0, len(new))
+			for name := range new {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("    %s: %q -> %q\n", name, old[name], new[name])
+			}
+		case historyInsert:
+			fmt.Printf("    %s\n", describeValues(new))
+		case historyRemove:
+			fmt.Printf("    %s\n", describeValues(old))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the history of VOD %s", vod))
+	}
+	if n == 0 {
+		fmt.Println("No history")
+	}
+
+	return nil
+}
+
+// describeValues is describeSegment for the values in lwod_history.
+func describeValues(values map[string]string) string {
+	return fmt.Sprintf("[%s-%s] %s", values["start"], values["end"], strings.Join([]string{values["game"], values["subject"], values["topic"]}, " | "))
+}
@@ -0,0 +1,243 @@
+package gsheets
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+)
+
+// the layout the LWOD folder has always had, year folders with spreadsheets
+// named after their month
+var defaultFolderPatterns = []string{
+	`^(?P<year>\d{4})$`,
+}
+
+// defaultSheetPatterns handle "07 July", "01 - Jan", "2023-01",
+// "January 2023" and "January"
+var defaultSheetPatterns = []string{
+	`^(?P<year>\d{4})\s*[-_./]\s*(?P<month>\d{1,2})\b`,
+	`^(?P<month>\d{1,2})\b`,
+	`^(?P<month>[[:alpha:]]{3,})\.?\s*[-_,]?\s*(?P<year>\d{4})\b`,
+	`^(?P<month>[[:alpha:]]{3,})\b`,
+}
+
+// sheetDate is the year and the month of a spreadsheet, either of them 0 when
+// it's not known yet.
+type sheetDate struct {
+	Year  int
+	Month time.Month
+}
+
+func (d sheetDate) key() string {
+	return fmt.Sprintf("%04d-%02d", d.Year, d.Month)
+}
+
+func (d sheetDate) time() time.Time {
+	return time.Date(d.Year, d.Month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// layoutFolder is a folder the spreadsheets are in, along with the date its
+// name and the names of the folders above it gave.
+type layoutFolder struct {
+	ID   string
+	date sheetDate
+}
+
+type layoutSheet struct {
+	File   SheetFile
+	Folder string
+	date   sheetDate
+}
+
+type sheetLayout struct {
+	folders, sheets []*regexp.Regexp
+}
+
+// newSheetLayout compiles the configured layout, the patterns are checked
+// when the config gets loaded.
+func newSheetLayout(config *config.Config) sheetLayout {
+	folders, sheets := config.LWODLayout.Folders, config.LWODLayout.Sheets
+	if folders == nil {
+		folders = defaultFolderPatterns
+	}
+	if sheets == nil {
+		sheets = defaultSheetPatterns
+	}
+
+	var layout sheetLayout
+	for _, pattern := range folders {
+		layout.folders = append(layout.folders, regexp.MustCompile(pattern))
+	}
+	for _, pattern := range sheets {
+		layout.sheets = append(layout.sheets, regexp.MustCompile(pattern))
+	}
+	return layout
+}
+
+// leafFolders walks the folder levels of the layout down from the root
+// folder, returning the folders the spreadsheets should be in. Folders with
+// a year wantYear returns false for aren't walked, a nil wantYear walks all.
+func (l sheetLayout) leafFolders(src SheetSource, rootID string, wantYear func(int) bool) ([]layoutFolder, error) {
+	leaves, _, err := l.walkFolders(src, rootID, wantYear)
+	return leaves, err
+}
+
+// walkFolders is leafFolders that also returns the IDs of every folder of
+// the layout it went through, the root and the leaves included.
+func (l sheetLayout) walkFolders(src SheetSource, rootID string, wantYear func(int) bool) ([]layoutFolder, []string, error) {
+	folders := []layoutFolder{{ID: rootID}}
+	ids := []string{rootID}
+	for _, re := range l.folders {
+		var next []layoutFolder
+		for _, folder := range folders {
+			result, err := src.ListFiles(folder.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, file := range result {
+				if file.MimeType != mimeFolder {
+					continue
+				}
+				date, ok := matchDate(re, file.Name, folder.date)
+				if !ok {
+					log.Debugf(`[LWOD] Folder %s ("%s") doesn't match "%s", skipping`, file.ID, file.Name, re)
+					continue
+				}
+				if date.Year != 0 && wantYear != nil && !wantYear(date.Year) {
+					continue
+				}
+				next = append(next, layoutFolder{
+					ID:   file.ID,
+					date: date,
+				})
+				ids = append(ids, file.ID)
+			}
+		}
+		folders = next
+	}
+
+	return folders, ids, nil
+}
+
+// sheetsIn lists the spreadsheets in the folders, along with the ones whose
+// year and month couldn't be figured out.
+func (l sheetLayout) sheetsIn(src SheetSource, folders []layoutFolder) ([]layoutSheet, []SheetFile, error) {
+	var found []layoutSheet
+	var unrecognized []SheetFile
+	for _, folder := range folders {
+		result, err := src.ListFiles(folder.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range result {
+			if file.MimeType != mimeSpreadsheet {
+				continue
+			}
+			sheet, ok := l.parseSheet(file, folder)
+			if !ok {
+				unrecognized = append(unrecognized, file)
+				continue
+			}
+			found = append(found, sheet)
+		}
+	}
+
+	return found, unrecognized, nil
+}
+
+// parseSheet figures out the year and the month of the spreadsheet from its
+// name and its folder.
+func (l sheetLayout) parseSheet(file SheetFile, folder layoutFolder) (layoutSheet, bool) {
+	for _, re := range l.sheets {
+		date, ok := matchDate(re, file.Name, folder.date)
+		if ok && date.Year != 0 && date.Month != 0 {
+			return layoutSheet{
+				File:   file,
+				Folder: folder.ID,
+				date:   date,
+			}, true
+		}
+	}
+
+	return layoutSheet{}, false
+}
+
+// matchDate matches the name against the pattern, filling in the date with
+// the year and the month it captures.
+func matchDate(re *regexp.Regexp, name string, date sheetDate) (sheetDate, bool) {
+	matches := re.FindStringSubmatch(strings.TrimSpace(name))
+	if matches == nil {
+		return date, false
+	}
+
+	for i, capture := range re.SubexpNames() {
+		if matches[i] == "" {
+			continue
+		}
+		switch capture {
+		case "year":
+			year, ok := parseYear(matches[i])
+			if !ok {
+				return date, false
+			}
+			date.Year = year
+		case "month":
+			month, ok := parseMonth(matches[i])
+			if !ok {
+				return date, false
+			}
+			date.Month = month
+		}
+	}
+
+	return date, true
+}
+
+// parseYear accepts 4-digit years and 2-digit ones, which are taken to be in
+// the 2000s.
+func parseYear(s string) (int, bool) {
+	year, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	switch len(s) {
+	case 2:
+		return 2000 + year, true
+	case 4:
+		return year, true
+	}
+	return 0, false
+}
+
+// parseMonth accepts month numbers and English month names, full or
+// shortened to at least 3 letters.
+func parseMonth(s string) (time.Month, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > 12 {
+			return 0, false
+		}
+		return time.Month(n), true
+	}
+
+	s = strings.ToLower(s)
+	if len(s) < 3 {
+		return 0, false
+	}
+	for m := time.January; m <= time.December; m++ {
+		if strings.HasPrefix(strings.ToLower(m.String()), s) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+func reportUnrecognized(files []SheetFile) {
+	for _, file := range files {
+		log.Warnf(`[LWOD] Couldn't tell the year and the month of spreadsheet %s ("%s") from its name and folder, skipping`, file.ID, file.Name)
+	}
+}
@@ -0,0 +1,140 @@
+package gsheets
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+)
+
+func TestDefaultSheetPatterns(t *testing.T) {
+	layout := newSheetLayout(&config.Config{})
+	inYear := layoutFolder{ID: "folder2023", date: sheetDate{Year: 2023}}
+
+	tests := []struct {
+		name   string
+		folder layoutFolder
+		want   sheetDate
+		ok     bool
+	}{
+		{"07 July", inYear, sheetDate{2023, time.July}, true},
+		{"7", inYear, sheetDate{2023, time.July}, true},
+		{"01 - Jan", inYear, sheetDate{2023, time.January}, true},
+		{"2023-01", inYear, sheetDate{2023, time.January}, true},
+		{"2022_12 backup", inYear, sheetDate{2022, time.December}, true},
+		{"January 2023", inYear, sheetDate{2023, time.January}, true},
+		{"Sept. 2022", inYear, sheetDate{2022, time.September}, true},
+		{"Jan, 2024", inYear, sheetDate{2024, time.January}, true},
+		{"January", inYear, sheetDate{2023, time.January}, true},
+		{"  march  ", inYear, sheetDate{2023, time.March}, true},
+		// the year of the folder is overridden by the one in the name
+		{"2024-02", layoutFolder{}, sheetDate{2024, time.February}, true},
+		{"February 2024", layoutFolder{}, sheetDate{2024, time.February}, true},
+
+		// a month without a year anywhere isn't enough
+		{"January", layoutFolder{}, sheetDate{}, false},
+		{"07 July", layoutFolder{}, sheetDate{}, false},
+		// too short to tell the months apart
+		{"Ju", inYear, sheetDate{}, false},
+		{"Ma 2023", inYear, sheetDate{}, false},
+		{"13 Foo", inYear, sheetDate{}, false},
+		{"2023-13", inYear, sheetDate{}, false},
+		{"Notes", inYear, sheetDate{}, false},
+		{"Copy of the template", inYear, sheetDate{}, false},
+		{"", inYear, sheetDate{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sheet, ok := layout.parseSheet(SheetFile{Name: tt.name}, tt.folder)
+			if ok != tt.ok || sheet.date != tt.want {
+				t.Errorf("parseSheet(%q) = %+v, %v, want %+v, %v", tt.name, sheet.date, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMatchDate(t *testing.T) {
+	// a custom pattern with a 2-digit year
+	re := regexp.MustCompile(`^(?P<month>\d{2})\.(?P<year>\d{2,4})$`)
+
+	tests := []struct {
+		name string
+		want sheetDate
+		ok   bool
+	}{
+		{"07.23", sheetDate{2023, time.July}, true},
+		{"12.99", sheetDate{2099, time.December}, true},
+		{"01.2021", sheetDate{2021, time.January}, true},
+		{"07.123", sheetDate{}, false},
+		{"13.23", sheetDate{}, false},
+		{"July 2023", sheetDate{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := matchDate(re, tt.name, sheetDate{Year: 2020})
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("matchDate(%q) = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseYear(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+		ok   bool
+	}{
+		{"2023", 2023, true},
+		{"1999", 1999, true},
+		{"23", 2023, true},
+		{"00", 2000, true},
+		{"7", 0, false},
+		{"123", 0, false},
+		{"20231", 0, false},
+		{"year", 0, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := parseYear(tt.s); got != tt.want || ok != tt.ok {
+			t.Errorf("parseYear(%q) = %d, %v, want %d, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseMonth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Month
+		ok   bool
+	}{
+		{"1", time.January, true},
+		{"07", time.July, true},
+		{"12", time.December, true},
+		{"0", 0, false},
+		{"13", 0, false},
+		{"January", time.January, true},
+		{"JAN", time.January, true},
+		{"sept", time.September, true},
+		{"Marc", time.March, true},
+		// the first 3 letters tell all the months apart, fewer don't
+		{"Jun", time.June, true},
+		{"Jul", time.July, true},
+		{"Mar", time.March, true},
+		{"May", time.May, true},
+		{"Ju", 0, false},
+		{"Ma", 0, false},
+		{"J", 0, false},
+		{"", 0, false},
+		{"Julyy", 0, false},
+		{"Marz", 0, false},
+		{"Notes", 0, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := parseMonth(tt.s); got != tt.want || ok != tt.ok {
+			t.Errorf("parseMonth(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package gsheets
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	PlatformYouTube = "youtube"
+	PlatformTwitch  = "twitch"
+	PlatformRumble  = "rumble"
+	PlatformKick    = "kick"
+	PlatformOdysee  = "odysee"
+)
+
+// VODLink is a VOD (and the offset into it) found in an LWOD cell.
+type VODLink struct {
+	Platform string
+	ID       string
+	Offset   int
+}
+
+// URL links to the VOD at the offset.
+func (l VODLink) URL() string {
+	switch l.Platform {
+	case PlatformYouTube:
+		return fmt.Sprintf("https://youtu.be/%s?t=%d", l.ID, l.Offset)
+	case PlatformTwitch:
+		return fmt.Sprintf("https://www.twitch.tv/videos/%s?t=%dh%dm%ds", l.ID, l.Offset/3600, l.Offset/60%60, l.Offset%60)
+	case PlatformRumble:
+		if strings.HasPrefix(l.ID, rumbleEmbedPrefix) {
+			return fmt.Sprintf("https://rumble.com/embed/%s/?start=%d", strings.TrimPrefix(l.ID, rumbleEmbedPrefix), l.Offset)
+		}
+		return fmt.Sprintf("https://rumble.com/%s.html?start=%d", l.ID, l.Offset)
+	case PlatformKick:
+		return fmt.Sprintf("https://kick.com/video/%s?t=%d", l.ID, l.Offset)
+	case PlatformOdysee:
+		return fmt.Sprintf("https://odysee.com%s?t=%d", l.ID, l.Offset)
+	}
+	return ""
+}
+
+// LinkExtractor recognizes the VOD links of a single platform. The URL passed
+// to Match has its host lowercased and stripped of "www." and "m.".
+type LinkExtractor interface {
+	Match(u *url.URL) (platform string, id string, offset int, ok bool)
+}
+
+// LinkExtractorFunc lets a plain function be used as a LinkExtractor.
+type LinkExtractorFunc func(u *url.URL) (string, string, int, bool)
+
+func (f LinkExtractorFunc) Match(u *url.URL) (string, string, int, bool) {
+	return f(u)
+}
+
+var linkExtractors = []LinkExtractor{
+	LinkExtractorFunc(matchYouTube),
+	LinkExtractorFunc(matchTwitch),
+	LinkExtractorFunc(matchRumble),
+	LinkExtractorFunc(matchKick),
+	LinkExtractorFunc(matchOdysee),
+}
+
+// RegisterLinkExtractor adds an extractor that's tried after all the
+// previously registered ones. Links to hosts the built-in extractors don't
+// handle are only recognized with a scheme.
+func RegisterLinkExtractor(e LinkExtractor) {
+	linkExtractors = append(linkExtractors, e)
+}
+
+var youtubeIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+var twitchIDRegex = regexp.MustCompile(`^v?(\d+)$`)
+var rumblePageRegex = regexp.MustCompile(`^(v[a-z0-9]*\d[a-z0-9]*)(?:-.*)?(?:\.html)?$`)
+var kickIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// the hosts of the built-in extractors, which are recognized without a
+// scheme too
+var knownLinkHosts = map[string]bool{
+	"youtube.com":          true,
+	"youtu.be":             true,
+	"music.youtube.com":    true,
+	"youtube-nocookie.com": true,
+	"twitch.tv":            true,
+	"player.twitch.tv":     true,
+	"rumble.com":           true,
+	"kick.com":             true,
+	"odysee.com":           true,
+}
+
+// looksLikeURL reports whether the value is worth parsing as a link: it has
+// a scheme, or it starts with one of the known hosts.
+func looksLikeURL(raw string) bool {
+	if strings.Contains(raw, "://") {
+		return true
+	}
+
+	host := strings.ToLower(raw)
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "m.")
+	return knownLinkHosts[host]
+}
+
+// ExtractLink runs the raw cell value through the registered extractors,
+// returning false if none of them recognized it or it doesn't look like a
+// URL at all (plain text in a link cell), and an error only if it looked
+// like a URL but couldn't be parsed.
+func ExtractLink(raw string) (VODLink, bool, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.ContainsAny(raw, " \t\n") || !looksLikeURL(raw) {
+		return VODLink{}, false, nil
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return VODLink{}, false, err
+	}
+	u.Host = strings.ToLower(u.Hostname())
+	u.Host = strings.TrimPrefix(u.Host, "www.")
+	u.Host = strings.TrimPrefix(u.Host, "m.")
+
+	for _, e := range linkExtractors {
+		platform, id, offset, ok := e.Match(u)
+		if ok {
+			return VODLink{
+				Platform: platform,
+				ID:       id,
+				Offset:   offset,
+			}, true, nil
+		}
+	}
+
+	return VODLink{}, false, nil
+}
+
+// urlOffset returns the offset from the first of the given query (or
+// fragment) parameters that's set.
+func urlOffset(u *url.URL, params ...string) int {
+	fragment, _ := url.ParseQuery(u.Fragment)
+	for _, p := range params {
+		for _, values := range []url.Values{u.Query(), fragment} {
+			if t := values.Get(p); t != "" {
+				offset, err := parseTimestamp(t)
+				if err != nil {
+					return 0
+				}
+				return offset
+			}
+		}
+	}
+
+	return 0
+}
+
+func pathParts(u *url.URL) []string {
+	return strings.FieldsFunc(u.Path, func(r rune) bool {
+		return r == '/'
+	})
+}
+
+// youtu.be/<id>, youtube.com/watch?v=<id>, youtube.com/live/<id>,
+// youtube.com/embed/<id>, youtube.com/shorts/<id>, youtube.com/v/<id>
+// and the same on music.youtube.com and youtube-nocookie.com
+func matchYouTube(u *url.URL) (string, string, int, bool) {
+	var id string
+	parts := pathParts(u)
+
+	switch u.Host {
+	case "youtu.be":
+		if len(parts) > 0 {
+			id = parts[0]
+		}
+	case "youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		switch {
+		case len(parts) == 1 && parts[0] == "watch":
+			id = u.Query().Get("v")
+		case len(parts) >= 2 && (parts[0] == "live" || parts[0] == "embed" || parts[0] == "shorts" || parts[0] == "v"):
+			id = parts[1]
+		}
+	default:
+		return "", "", 0, false
+	}
+
+	if !youtubeIDRegex.MatchString(id) {
+		return "", "", 0, false
+	}
+	return PlatformYouTube, id, urlOffset(u, "t", "start"), true
+}
+
+// twitch.tv/videos/<id>, twitch.tv/<channel>/v/<id>,
+// twitch.tv/<channel>/video/<id> and player.twitch.tv/?video=v<id>
+func matchTwitch(u *url.URL) (string, string, int, bool) {
+	var id string
+	parts := pathParts(u)
+
+	switch u.Host {
+	case "twitch.tv":
+		switch {
+		case len(parts) >= 2 && parts[0] == "videos":
+			id = parts[1]
+		case len(parts) >= 3 && (parts[1] == "v" || parts[1] == "video"):
+			id = parts[2]
+		}
+	case "player.twitch.tv":
+		id = u.Query().Get("video")
+	default:
+		return "", "", 0, false
+	}
+
+	matches := twitchIDRegex.FindStringSubmatch(id)
+	if matches == nil {
+		return "", "", 0, false
+	}
+	return PlatformTwitch, matches[1], urlOffset(u, "t", "time"), true
+}
+
+// the embeds have IDs of their own, which don't work as video page IDs
+const rumbleEmbedPrefix = "embed/"
+
+// rumble.com/embed/<id>/ and rumble.com/v<id>-<title>.html, the embed IDs
+// being kept as "embed/<id>"
+func matchRumble(u *url.URL) (string, string, int, bool) {
+	if u.Host != "rumble.com" {
+		return "", "", 0, false
+	}
+
+	var id string
+	parts := pathParts(u)
+	switch {
+	case len(parts) >= 2 && parts[0] == "embed":
+		id = rumbleEmbedPrefix + parts[1]
+	case len(parts) == 1:
+		if matches := rumblePageRegex.FindStringSubmatch(parts[0]); matches != nil {
+			id = matches[1]
+		}
+	}
+
+	if id == "" {
+		return "", "", 0, false
+	}
+	return PlatformRumble, id, urlOffset(u, "t", "start"), true
+}
+
+// kick.com/video/<uuid> and kick.com/<channel>/videos/<uuid>
+func matchKick(u *url.URL) (string, string, int, bool) {
+	if u.Host != "kick.com" {
+		return "", "", 0, false
+	}
+
+	var id string
+	parts := pathParts(u)
+	switch {
+	case len(parts) >= 2 && parts[0] == "video":
+		id = parts[1]
+	case len(parts) >= 3 && parts[1] == "videos":
+		id = parts[2]
+	}
+
+	if !kickIDRegex.MatchString(id) {
+		return "", "", 0, false
+	}
+	return PlatformKick, id, urlOffset(u, "t"), true
+}
+
+// odysee.com/@<channel>:<id>/<claim>:<id>, odysee.com/<claim>:<id> and
+// odysee.com/$/embed/<claim>/<id>, the ID being the claim path
+func matchOdysee(u *url.URL) (string, string, int, bool) {
+	if u.Host != "odysee.com" {
+		return "", "", 0, false
+	}
+
+	parts := pathParts(u)
+	if len(parts) >= 3 && parts[0] == "$" && parts[1] == "embed" {
+		parts = parts[2:]
+		if len(parts) == 2 && !strings.HasPrefix(parts[0], "@") {
+			parts = []string{parts[0] + ":" + parts[1]}
+		}
+	}
+	if len(parts) == 0 || parts[0] == "$" || (len(parts) == 1 && strings.HasPrefix(parts[0], "@")) {
+		return "", "", 0, false
+	}
+
+	return PlatformOdysee, "/" + strings.Join(parts, "/"), urlOffset(u, "t"), true
+}
@@ -0,0 +1,119 @@
+package gsheets
+
+import "testing"
+
+func TestExtractLink(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want VODLink
+		ok   bool
+	}{
+		// YouTube
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 0}, true},
+		{"https://youtube.com/watch?v=dQw4w9WgXcQ&t=90", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 90}, true},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ&t=1h2m3s", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 3723}, true},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ#t=90", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 90}, true},
+		{"https://www.youtube.com/live/dQw4w9WgXcQ?t=5", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 5}, true},
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ?start=5", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 5}, true},
+		{"https://www.youtube.com/shorts/dQw4w9WgXcQ", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 0}, true},
+		{"https://www.youtube.com/v/dQw4w9WgXcQ", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 0}, true},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 0}, true},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 0}, true},
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 42}, true},
+		{"HTTPS://YOUTU.BE/dQw4w9WgXcQ", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 0}, true},
+		{"youtu.be/dQw4w9WgXcQ?t=42", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 42}, true},
+		{"www.youtube.com/watch?v=dQw4w9WgXcQ", VODLink{PlatformYouTube, "dQw4w9WgXcQ", 0}, true},
+		{"https://www.youtube.com/watch?v=short", VODLink{}, false},
+		{"https://www.youtube.com/channel/UC123", VODLink{}, false},
+
+		// Twitch
+		{"https://www.twitch.tv/videos/1234567890", VODLink{PlatformTwitch, "1234567890", 0}, true},
+		{"https://www.twitch.tv/videos/1234567890?t=1h2m3s", VODLink{PlatformTwitch, "1234567890", 3723}, true},
+		{"https://m.twitch.tv/videos/1234567890?time=60", VODLink{PlatformTwitch, "1234567890", 60}, true},
+		{"https://www.twitch.tv/destiny/v/1234567890", VODLink{PlatformTwitch, "1234567890", 0}, true},
+		{"https://www.twitch.tv/destiny/video/1234567890", VODLink{PlatformTwitch, "1234567890", 0}, true},
+		{"https://player.twitch.tv/?video=v1234567890", VODLink{PlatformTwitch, "1234567890", 0}, true},
+		{"twitch.tv/videos/1234567890", VODLink{PlatformTwitch, "1234567890", 0}, true},
+		{"https://www.twitch.tv/destiny", VODLink{}, false},
+
+		// Rumble
+		{"https://rumble.com/v2abc12-some-title.html", VODLink{PlatformRumble, "v2abc12", 0}, true},
+		{"https://rumble.com/v2abc12-some-title.html?start=30", VODLink{PlatformRumble, "v2abc12", 30}, true},
+		{"https://rumble.com/embed/v2xyz34/?t=30", VODLink{PlatformRumble, "embed/v2xyz34", 30}, true},
+		{"rumble.com/v2abc12-some-title.html", VODLink{PlatformRumble, "v2abc12", 0}, true},
+		{"https://rumble.com/c/destiny", VODLink{}, false},
+
+		// Kick
+		{"https://kick.com/video/0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b", VODLink{PlatformKick, "0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b", 0}, true},
+		{"https://kick.com/destiny/videos/0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b?t=10", VODLink{PlatformKick, "0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b", 10}, true},
+		{"kick.com/video/0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b", VODLink{PlatformKick, "0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b", 0}, true},
+		{"https://kick.com/destiny", VODLink{}, false},
+
+		// Odysee
+		{"https://odysee.com/@destiny:7/stream:a?t=20", VODLink{PlatformOdysee, "/@destiny:7/stream:a", 20}, true},
+		{"https://odysee.com/stream:a", VODLink{PlatformOdysee, "/stream:a", 0}, true},
+		{"https://odysee.com/$/embed/stream/a", VODLink{PlatformOdysee, "/stream:a", 0}, true},
+		{"odysee.com/@destiny:7/stream:a", VODLink{PlatformOdysee, "/@destiny:7/stream:a", 0}, true},
+		{"https://odysee.com/@destiny:7", VODLink{}, false},
+		{"https://odysee.com/$/settings", VODLink{}, false},
+
+		// not links
+		{"", VODLink{}, false},
+		{"50%", VODLink{}, false},
+		{"[1]", VODLink{}, false},
+		{"a%zz", VODLink{}, false},
+		{"n/a", VODLink{}, false},
+		{"1:02:03", VODLink{}, false},
+		{"youtube", VODLink{}, false},
+		{"https://example.com/video/1", VODLink{}, false},
+		{"youtu.be/dQw4w9WgXcQ and more", VODLink{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, ok, err := ExtractLink(tt.raw)
+			if err != nil {
+				t.Fatalf("ExtractLink(%q) returned an error: %v", tt.raw, err)
+			}
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ExtractLink(%q) = %+v, %v, want %+v, %v", tt.raw, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExtractLinkError(t *testing.T) {
+	// only values that look like URLs can be errors
+	if _, _, err := ExtractLink("https://youtu.be/%zz"); err == nil {
+		t.Errorf("expected an error for a broken URL")
+	}
+}
+
+func TestVODLinkURL(t *testing.T) {
+	tests := []struct {
+		link VODLink
+		want string
+	}{
+		{VODLink{PlatformYouTube, "dQw4w9WgXcQ", 90}, "https://youtu.be/dQw4w9WgXcQ?t=90"},
+		{VODLink{PlatformTwitch, "1234567890", 3723}, "https://www.twitch.tv/videos/1234567890?t=1h2m3s"},
+		{VODLink{PlatformRumble, "v2abc12", 30}, "https://rumble.com/v2abc12.html?start=30"},
+		{VODLink{PlatformRumble, "embed/v2xyz34", 30}, "https://rumble.com/embed/v2xyz34/?start=30"},
+		{VODLink{PlatformKick, "0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b", 10}, "https://kick.com/video/0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b?t=10"},
+		{VODLink{PlatformOdysee, "/@destiny:7/stream:a", 20}, "https://odysee.com/@destiny:7/stream:a?t=20"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.link.URL(); got != tt.want {
+			t.Errorf("%+v.URL() = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+
+	// an embed link makes it back to the same embed
+	link, ok, err := ExtractLink("https://rumble.com/embed/v2xyz34/?t=30")
+	if err != nil || !ok {
+		t.Fatalf("ExtractLink didn't recognize the embed link: %v, %v", ok, err)
+	}
+	if got, want := link.URL(), "https://rumble.com/embed/v2xyz34/?start=30"; got != want {
+		t.Errorf("the embed link's URL is %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,421 @@
+package gsheets
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+	"github.com/xuri/excelize/v2"
+	"google.golang.org/api/sheets/v4"
+)
+
+type localWorksheet struct {
+	Title string
+	Rows  [][]*sheets.CellData
+}
+
+// LoadLocalSheets reads LWOD spreadsheet exports from path, which is either a
+// single XLSX/ODS/CSV file or a directory of them. Every XLSX and ODS file
+// becomes one spreadsheet, while all the CSV files in a directory are treated
+// as the worksheets of a single spreadsheet named after that directory.
+func LoadLocalSheets(path string) (map[string]LWODSheet, *MemorySource, error) {
+	lwod := make(map[string]LWODSheet)
+	src := NewMemorySource()
+	csvs := make(map[string][]string)
+
+	add := func(key, id, name string, worksheets []localWorksheet) {
+		lwod[key] = LWODSheet{
+			ID:     id,
+			Name:   name,
+			Folder: path,
+			Local:  true,
+		}
+		src.AddSpreadsheet(path, name, newLocalSpreadsheet(id, name, worksheets))
+	}
+
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		var worksheets []localWorksheet
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".xlsx":
+			worksheets, err = readXLSX(p)
+		case ".ods":
+			worksheets, err = readODS(p)
+		case ".csv":
+			csvs[filepath.Dir(p)] = append(csvs[filepath.Dir(p)], p)
+			return nil
+		default:
+			log.Debugf("[LWOD] Skipping unsupported file %s", p)
+			return nil
+		}
+		if err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't read %s", p))
+		}
+
+		name := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+		add(localSheetKey(path, p), p, name, worksheets)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for dir, paths := range csvs {
+		var worksheets []localWorksheet
+		for _, p := range paths {
+			records, err := readCSV(p)
+			if err != nil {
+				return nil, nil, WrapWithLWODError(err, fmt.Sprintf("Couldn't read %s", p))
+			}
+			rows := make([][]*sheets.CellData, len(records))
+			for r, record := range records {
+				for _, v := range record {
+					rows[r] = append(rows[r], &sheets.CellData{
+						FormattedValue: v,
+					})
+				}
+			}
+			worksheets = append(worksheets, localWorksheet{
+				Title: strings.TrimSuffix(filepath.Base(p), filepath.Ext(p)),
+				Rows:  rows,
+			})
+		}
+		// a lone csv file passed directly is named after itself
+		name := filepath.Base(dir)
+		key := localSheetKey(path, dir)
+		if len(paths) == 1 && filepath.Clean(paths[0]) == filepath.Clean(path) {
+			name = worksheets[0].Title
+			key = "local/" + name
+		}
+		add(key, dir, name, worksheets)
+	}
+
+	return lwod, src, nil
+}
+
+// ImportSheets parses local spreadsheet exports the same way the Google Sheets
+// ones are parsed and writes the results to the LWOD DB.
+func ImportSheets(path string, config *config.Config) error {
+	lwod, src, err := LoadLocalSheets(path)
+	if err != nil {
+		return err
+	}
+	if len(lwod) == 0 {
+		return WrapWithLWODError(fs.ErrNotExist, fmt.Sprintf("No XLSX, ODS or CSV files found in %s", path))
+	}
+
+	return ParseSheets(src, lwod, config)
+}
+
+func localSheetKey(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." {
+		rel = filepath.Base(p)
+	}
+	// prefixed so a file named like a month isn't mistaken for a Drive sheet
+	return "local/" + strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+}
+
+func newLocalSpreadsheet(id, title string, worksheets []localWorksheet) *sheets.Spreadsheet {
+	file := &sheets.Spreadsheet{
+		SpreadsheetId: id,
+		Properties: &sheets.SpreadsheetProperties{
+			Title: title,
+		},
+	}
+
+	for i, ws := range worksheets {
+		rowData := make([]*sheets.RowData, len(ws.Rows))
+		for r, row := range ws.Rows {
+			rowData[r] = &sheets.RowData{
+				Values: row,
+			}
+		}
+		file.Sheets = append(file.Sheets, &sheets.Sheet{
+			Properties: &sheets.SheetProperties{
+				SheetId: int64(i),
+				Index:   int64(i),
+				Title:   ws.Title,
+			},
+			Data: []*sheets.GridData{
+				{
+					RowData: rowData,
+				},
+			},
+		})
+	}
+
+	return file
+}
+
+func readCSV(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	return r.ReadAll()
+}
+
+func readXLSX(path string) ([]localWorksheet, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	comments := f.GetComments()
+
+	var worksheets []localWorksheet
+	for _, name := range f.GetSheetList() {
+		values, err := f.GetRows(name)
+		if err != nil {
+			return nil, err
+		}
+
+		rows := make([][]*sheets.CellData, len(values))
+		for r, row := range values {
+			for c, v := range row {
+				cell := &sheets.CellData{
+					FormattedValue: v,
+				}
+				rows[r] = append(rows[r], cell)
+				if v == "" {
+					continue
+				}
+
+				axis, err := excelize.CoordinatesToCellName(c+1, r+1)
+				if err != nil {
+					return nil, err
+				}
+				ok, link, err := f.GetCellHyperLink(name, axis)
+				if err != nil {
+					return nil, err
+				}
+				if ok && strings.Contains(link, "://") {
+					cell.Hyperlink = link
+				}
+				formula, err := f.GetCellFormula(name, axis)
+				if err != nil {
+					return nil, err
+				}
+				if formula != "" {
+					formula = "=" + formula
+					cell.UserEnteredValue = &sheets.ExtendedValue{
+						FormulaValue: &formula,
+					}
+				}
+			}
+		}
+
+		for _, comment := range comments[name] {
+			c, r, err := excelize.CellNameToCoordinates(comment.Ref)
+			if err != nil {
+				return nil, err
+			}
+			for len(rows) < r {
+				rows = append(rows, nil)
+			}
+			for len(rows[r-1]) < c {
+				rows[r-1] = append(rows[r-1], &sheets.CellData{})
+			}
+			// excelize puts the author's name in front of the text
+			rows[r-1][c-1].Note = strings.TrimPrefix(strings.TrimPrefix(comment.Text, comment.Author), ":")
+		}
+
+		worksheets = append(worksheets, localWorksheet{
+			Title: name,
+			Rows:  rows,
+		})
+	}
+
+	return worksheets, nil
+}
+
+// readODS walks content.xml of an OpenDocument spreadsheet, expanding repeated
+// rows and cells. Repeated blank rows and cells are only materialized when
+// something non-blank follows them, since ODS files pad their tables with
+// huge runs of empty cells.
+func readODS(path string) ([]localWorksheet, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var content io.ReadCloser
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			content, err = f.Open()
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%s has no content.xml", path)
+	}
+	defer content.Close()
+
+	var worksheets []localWorksheet
+	var ws *localWorksheet
+	var row []*sheets.CellData
+	var cell, note strings.Builder
+	var link string
+	var inCell, inAnnotation, inNote, cellHasText, noteHasText bool
+	rowRepeat, cellRepeat := 1, 1
+	pendingRows, pendingCells := 0, 0
+
+	d := xml.NewDecoder(content)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				worksheets = append(worksheets, localWorksheet{
+					Title: odsAttr(t, "name"),
+				})
+				ws = &worksheets[len(worksheets)-1]
+				pendingRows = 0
+			case "table-row":
+				row = nil
+				pendingCells = 0
+				rowRepeat = odsRepeat(t, "number-rows-repeated")
+			case "table-cell", "covered-table-cell":
+				inCell = true
+				cellHasText = false
+				noteHasText = false
+				cell.Reset()
+				note.Reset()
+				link = ""
+				cellRepeat = odsRepeat(t, "number-columns-repeated")
+			case "annotation":
+				inAnnotation = true
+			case "p":
+				if inAnnotation {
+					if noteHasText {
+						note.WriteString("\n")
+					}
+					noteHasText = true
+					inNote = true
+					continue
+				}
+				if inCell && cellHasText {
+					cell.WriteString("\n")
+				}
+				cellHasText = true
+			case "s":
+				if inCell && !inAnnotation {
+					cell.WriteString(strings.Repeat(" ", odsRepeat(t, "c")))
+				}
+			case "a":
+				if inCell && !inAnnotation && link == "" {
+					link = odsAttr(t, "href")
+				}
+			case "tab":
+				if inCell {
+					cell.WriteString("\t")
+				}
+			case "line-break":
+				if inCell {
+					cell.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			switch {
+			case inCell && inAnnotation:
+				// skip the author and date of the annotation
+				if inNote {
+					note.Write(t)
+				}
+			case inCell:
+				cell.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "annotation":
+				inAnnotation = false
+			case "p":
+				inNote = false
+			case "table-cell", "covered-table-cell":
+				inCell = false
+				if cell.Len() == 0 && note.Len() == 0 {
+					pendingCells += cellRepeat
+					continue
+				}
+				for ; pendingCells > 0; pendingCells-- {
+					row = append(row, &sheets.CellData{})
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, &sheets.CellData{
+						FormattedValue: cell.String(),
+						Hyperlink:      link,
+						Note:           note.String(),
+					})
+				}
+			case "table-row":
+				if ws == nil {
+					continue
+				}
+				if len(row) == 0 {
+					pendingRows += rowRepeat
+					continue
+				}
+				for ; pendingRows > 0; pendingRows-- {
+					ws.Rows = append(ws.Rows, nil)
+				}
+				for i := 0; i < rowRepeat; i++ {
+					ws.Rows = append(ws.Rows, row)
+				}
+			}
+		}
+	}
+
+	return worksheets, nil
+}
+
+func odsAttr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func odsRepeat(t xml.StartElement, name string) int {
+	n, err := strconv.Atoi(odsAttr(t, name))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
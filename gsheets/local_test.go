@@ -0,0 +1,159 @@
+package gsheets
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// testCell is the part of a CellData the local readers fill in.
+type testCell struct {
+	Value, Link, Note, Formula string
+}
+
+func testCells(rows [][]*sheets.CellData) [][]testCell {
+	cells := make([][]testCell, len(rows))
+	for r, row := range rows {
+		for _, c := range row {
+			cell := testCell{Value: c.FormattedValue, Link: c.Hyperlink, Note: c.Note}
+			if c.UserEnteredValue != nil && c.UserEnteredValue.FormulaValue != nil {
+				cell.Formula = *c.UserEnteredValue.FormulaValue
+			}
+			cells[r] = append(cells[r], cell)
+		}
+	}
+	return cells
+}
+
+func testValues(v ...string) []testCell {
+	cells := make([]testCell, len(v))
+	for i := range v {
+		cells[i].Value = v[i]
+	}
+	return cells
+}
+
+func TestReadCSV(t *testing.T) {
+	records, err := readCSV("testdata/local/csv/Sheet1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rows don't have to be the same length
+	want := [][]string{
+		{"Date", "Start", "End", "Topic", "YouTube"},
+		{"15/03/23", "0:00", "1:00", "a, b", "https://youtu.be/dQw4w9WgXcQ"},
+		{"", "1:00"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("readCSV = %q, want %q", records, want)
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	worksheets, err := readXLSX("testdata/local/march.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(worksheets) != 2 || worksheets[0].Title != "March" || worksheets[1].Title != "Notes" {
+		t.Fatalf("readXLSX returned %d worksheet(s), want March and Notes", len(worksheets))
+	}
+
+	link := "https://youtu.be/aaaaaaaaaaa"
+	want := [][]testCell{
+		testValues("Date", "Start", "End", "Game", "Subject", "Topic", "YouTube"),
+		append(testValues("15/03/23", "0:00", "1:00", "Chess", "Destiny"),
+			testCell{Value: "first", Note: "timestamps are off"},
+			testCell{Value: "link", Link: "https://youtu.be/dQw4w9WgXcQ?t=10"},
+		),
+		append(testValues("", "1:00", "2:00", "", "Destiny", "second"),
+			testCell{Value: link, Formula: `=HYPERLINK("` + link + `","` + link + `")`},
+		),
+	}
+	if got := testCells(worksheets[0].Rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("March = %+v, want %+v", got, want)
+	}
+	if got, want := testCells(worksheets[1].Rows), [][]testCell{testValues("nothing here")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Notes = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadODS(t *testing.T) {
+	worksheets, err := readODS("testdata/local/april.ods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(worksheets) != 1 || worksheets[0].Title != "April" {
+		t.Fatalf("readODS returned %d worksheet(s), want April", len(worksheets))
+	}
+
+	// the blank rows and cells are only kept when something follows them,
+	// and the repeated ones that aren't blank are expanded
+	want := [][]testCell{
+		testValues("Date", "Start", "End", "", "", "Topic", "YouTube"),
+		nil,
+		nil,
+		append(testValues("03/04/23", "0:00", "0:00", "", ""),
+			testCell{Value: "a  b\nc", Note: "first line\nsecond line"},
+			testCell{Value: "watch", Link: "https://youtu.be/dQw4w9WgXcQ?t=10"},
+		),
+		testValues("x"),
+		testValues("x"),
+	}
+	if got := testCells(worksheets[0].Rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("April = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadLocalSheets(t *testing.T) {
+	lwod, src, err := LoadLocalSheets("testdata/local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"local/march": {"March", "Notes"},
+		"local/april": {"April"},
+		// the csv files of a directory are the worksheets of one spreadsheet
+		"local/csv": {"Sheet1", "Sheet2"},
+	}
+	if len(lwod) != len(want) {
+		t.Fatalf("LoadLocalSheets found %+v, want %v", lwod, want)
+	}
+	for key, titles := range want {
+		sheet, ok := lwod[key]
+		if !ok || !sheet.Local {
+			t.Errorf("%s: got %+v, want a local sheet", key, sheet)
+			continue
+		}
+		file, err := src.GetSpreadsheet(sheet.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, ws := range file.Sheets {
+			got = append(got, ws.Properties.Title)
+		}
+		if !reflect.DeepEqual(got, titles) {
+			t.Errorf("%s has worksheets %q, want %q", key, got, titles)
+		}
+	}
+
+	file, err := src.GetSpreadsheet(lwod["local/csv"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := file.Sheets[1].Data[0].RowData
+	if len(rows) != 2 || rows[1].Values[1].FormattedValue != "multi\nline" {
+		t.Errorf("Sheet2 wasn't read as a worksheet of 2 rows: %+v", rows)
+	}
+
+	// a lone csv file is a spreadsheet of its own
+	lwod, _, err = LoadLocalSheets("testdata/local/csv/Sheet1.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet, ok := lwod["local/Sheet1"]; len(lwod) != 1 || !ok || sheet.Name != "Sheet1" {
+		t.Errorf("LoadLocalSheets of a csv file = %+v, want just local/Sheet1", lwod)
+	}
+}
@@ -3,6 +3,9 @@ package gsheets
 import (
 	"database/sql"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"google.golang.org/api/sheets/v4"
 )
@@ -27,6 +30,95 @@ func WrapWithLWODError(err error, message string) error {
 	}
 }
 
+// parseTimestamp converts a VOD timestamp parameter ("1h2m3s", "01h02m03s",
+// "3723s" or "3723") into seconds, returning 0 for anything it doesn't know.
+func parseTimestamp(t string) (int, error) {
+	matches := timestampRegex.FindStringSubmatch(strings.TrimSpace(t))
+	if matches == nil {
+		return 0, nil
+	}
+
+	stamp := 0
+	for _, unit := range []struct {
+		name       string
+		multiplier int
+	}{
+		{"hours", 60 * 60},
+		{"minutes", 60},
+		{"seconds", 1},
+	} {
+		match := matches[timestampRegex.SubexpIndex(unit.name)]
+		if match == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match)
+		if err != nil {
+			return 0, err
+		}
+		stamp += n * unit.multiplier
+	}
+
+	return stamp, nil
+}
+
+var hyperlinkFormulaRegex = regexp.MustCompile(`(?i)HYPERLINK\(\s*"([^"]+)"`)
+
+// cellLinks returns everything in the cell that might be a link - the cell's
+// own hyperlink, URLs of HYPERLINK formulas and rich text runs, and then every
+// word of the displayed text, since editors often hide the actual URL behind
+// some display text.
+func cellLinks(cell *sheets.CellData) []string {
+	var links []string
+	seen := make(map[string]bool)
+	add := func(link string) {
+		link = strings.TrimSpace(link)
+		if link != "" && !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	add(cell.Hyperlink)
+	if cell.UserEnteredValue != nil && cell.UserEnteredValue.FormulaValue != nil {
+		for _, m := range hyperlinkFormulaRegex.FindAllStringSubmatch(*cell.UserEnteredValue.FormulaValue, -1) {
+			add(m[1])
+		}
+	}
+	for _, run := range cell.TextFormatRuns {
+		if run.Format != nil && run.Format.Link != nil {
+			add(run.Format.Link.Uri)
+		}
+	}
+	for _, word := range strings.Fields(cell.FormattedValue) {
+		add(word)
+	}
+
+	return links
+}
+
+func (e LWODEntry) notesString() string {
+	var notes string
+	for _, n := range e.Notes {
+		notes += n.Field + n.Note
+	}
+	return notes
+}
+
+// source says where in the spreadsheets the entry came from, empty for the
+// rows added before that was stored.
+func (e LWODEntry) source() string {
+	if e.SheetID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s#gid=%d row %d", e.SheetID, e.WorksheetID, e.SheetRow+1)
+}
+
+// cellURL links to a cell of a Google Sheets worksheet, row and col being
+// 0-based.
+func cellURL(sheetID string, gid int64, row, col int) string {
+	return fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/edit#gid=%d&range=%s%d", sheetID, gid, columnName(col), row+1)
+}
+
 func fillWithBlank(v *[]*sheets.CellData, maxValueOfTemplate int64) {
 	if len(*v) < int(maxValueOfTemplate)+1 {
 		for i := len(*v); i < int(maxValueOfTemplate)+1; i++ {
@@ -58,26 +150,3 @@ func newNullString(s string) sql.NullString {
 		Valid:  true,
 	}
 }
-
-func dedupHashes(m map[string]string, e map[string][]LWODEntry) map[string][]LWODEntry {
-	dedupedHashes := make(map[string]string)
-
-	for key, valueOuter := range m {
-		exists := false
-		for _, valueInner := range dedupedHashes {
-			if valueInner == valueOuter {
-				exists = true
-			}
-		}
-		if !exists {
-			dedupedHashes[key] = valueOuter
-		}
-	}
-
-	dedupedEntries := make(map[string][]LWODEntry)
-	for key := range dedupedHashes {
-		dedupedEntries[key] = e[key]
-	}
-
-	return dedupedEntries
-}
@@ -0,0 +1,71 @@
+package gsheets
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/vyneer/lwodcollector/config"
+)
+
+// lwodPlatform is the entries of a worksheet grouped by the VOD IDs of one
+// platform, along with everything needed to sync them to the platform's table.
+type lwodPlatform struct {
+	// Name is used in the logs
+	Name string
+	// Table has the platform's VODs, Column is the lwod column with their IDs
+	Table, Column string
+	URLs          map[string][]LWODEntry
+	hash          func([]LWODEntry) string
+	selectHash    *sql.Stmt
+	upsert        *sql.Stmt
+}
+
+func lwodPlatforms(config *config.Config, yt, twitch, rumble, kick, odysee map[string][]LWODEntry) []lwodPlatform {
+	s := config.LWODDBConfig.Statements
+	return []lwodPlatform{
+		{"YouTube", "youtube", "vidid", yt, youtubeHash, s.SelectYTHashStmt, s.UpsertYTStmt},
+		{"Twitch", "twitch", "vodid", twitch, entriesHash, s.SelectTwitchHashStmt, s.UpsertTwitchStmt},
+		{"Rumble", "rumble", "rumbleid", rumble, entriesHash, s.SelectRumbleHashStmt, s.UpsertRumbleStmt},
+		{"Kick", "kick", "kickid", kick, entriesHash, s.SelectKickHashStmt, s.UpsertKickStmt},
+		{"Odysee", "odysee", "odyseeid", odysee, entriesHash, s.SelectOdyseeHashStmt, s.UpsertOdyseeStmt},
+	}
+}
+
+// hashVersion goes in front of the VOD hashes and gets bumped when what's
+// hashed changes, so the VODs hashed the old way are synced again once.
+// Version 2 added the notes, where the rows came from and the stream dates.
+const hashVersion = "2"
+
+func versionedHash(hashString string) string {
+	return hashVersion + "-" + strconv.FormatUint(xxhash.Sum64String(hashString), 10)
+}
+
+// hashOutdated reports whether the hash was made by an older version.
+func hashOutdated(hash string) bool {
+	return hash != "" && !strings.HasPrefix(hash, hashVersion+"-")
+}
+
+// youtubeHash covers the YouTube side of the entries, like the youtube table
+// has always been hashed, along with what version 2 added
+func youtubeHash(entries []LWODEntry) string {
+	var hashString string
+	for _, value := range entries {
+		hashString += value.YouTube + value.Start + value.End + strconv.Itoa(value.YouTubeStamp) + value.Game + value.Subject + value.Topic + value.notesString() + value.source() + value.DateStreamed.Format("2006-01-02")
+	}
+	return versionedHash(hashString)
+}
+
+func entriesHash(entries []LWODEntry) string {
+	var hashString string
+	for _, value := range entries {
+		hashString += value.Twitch + value.YouTube + value.Rumble + value.Kick + value.Odysee + value.Start + value.End + strconv.Itoa(value.YouTubeStamp) + strconv.Itoa(value.TwitchStamp) + strconv.Itoa(value.RumbleStamp) + strconv.Itoa(value.KickStamp) + strconv.Itoa(value.OdyseeStamp) + value.Game + value.Subject + value.Topic + value.notesString() + value.source() + value.DateStreamed.Format("2006-01-02")
+	}
+	return versionedHash(hashString)
+}
+
+// vodIDs are the entry's VOD IDs in the order of lwodPlatforms.
+func (e LWODEntry) vodIDs() []string {
+	return []string{e.YouTube, e.Twitch, e.Rumble, e.Kick, e.Odysee}
+}
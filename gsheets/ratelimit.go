@@ -0,0 +1,70 @@
+package gsheets
+
+import (
+	"github.com/vyneer/lwodcollector/config"
+	"github.com/vyneer/lwodcollector/util"
+	"google.golang.org/api/sheets/v4"
+)
+
+// rateLimitedSource keeps the requests of a SheetSource under the Drive and
+// the Sheets API quotas, the limiters being shared by all the workers.
+type rateLimitedSource struct {
+	src           SheetSource
+	drive, sheets *util.RateLimiter
+}
+
+// rateLimitedChangeSource is a rateLimitedSource over a ChangeSource, so the
+// changes can still be used.
+type rateLimitedChangeSource struct {
+	rateLimitedSource
+	changes ChangeSource
+}
+
+// NewRateLimitedSource wraps the source with the LWOD_DRIVE_RPS and
+// LWOD_SHEETS_RPS limits.
+func NewRateLimitedSource(src SheetSource, config *config.Config) SheetSource {
+	limited := rateLimitedSource{
+		src:    src,
+		drive:  util.NewRateLimiter(config.LWODDriveRPS),
+		sheets: util.NewRateLimiter(config.LWODSheetsRPS),
+	}
+	if changes, ok := src.(ChangeSource); ok {
+		return &rateLimitedChangeSource{
+			rateLimitedSource: limited,
+			changes:           changes,
+		}
+	}
+
+	return &limited
+}
+
+func (s *rateLimitedSource) ListFiles(parentID string) ([]SheetFile, error) {
+	s.drive.Wait()
+	return s.src.ListFiles(parentID)
+}
+
+func (s *rateLimitedSource) GetFile(id string) (SheetFile, error) {
+	s.drive.Wait()
+	return s.src.GetFile(id)
+}
+
+func (s *rateLimitedSource) GetSpreadsheet(id string) (*sheets.Spreadsheet, error) {
+	s.sheets.Wait()
+	return s.src.GetSpreadsheet(id)
+}
+
+func (s *rateLimitedSource) GetSpreadsheetJSON(id string) ([]byte, error) {
+	s.sheets.Wait()
+	return spreadsheetJSON(s.src, id)
+}
+
+func (s *rateLimitedChangeSource) StartPageToken() (string, error) {
+	s.drive.Wait()
+	return s.changes.StartPageToken()
+}
+
+// Changes only waits once, even though the changes can take several pages.
+func (s *rateLimitedChangeSource) Changes(pageToken string) ([]SheetFile, string, error) {
+	s.drive.Wait()
+	return s.changes.Changes(pageToken)
+}
@@ -0,0 +1,140 @@
+package gsheets
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/vyneer/lwodcollector/logger"
+)
+
+// sheetContents is which VODs a parsed spreadsheet has in which worksheets.
+type sheetContents struct {
+	// VODs by worksheet gid, as "<lwod column>\x00<ID>"
+	vods map[int64]map[string]bool
+	// worksheets that couldn't be parsed, whose rows are left alone
+	skipped map[int64]bool
+	// rows that couldn't be parsed (in lenient mode) by worksheet gid, whose
+	// segments are left alone too
+	failed map[int64]map[int]bool
+}
+
+func newSheetContents() sheetContents {
+	return sheetContents{
+		vods:    make(map[int64]map[string]bool),
+		skipped: make(map[int64]bool),
+		failed:  make(map[int64]map[int]bool),
+	}
+}
+
+func (c sheetContents) fail(worksheetID int64, row int) {
+	if c.failed[worksheetID] == nil {
+		c.failed[worksheetID] = make(map[int]bool)
+	}
+	c.failed[worksheetID][row] = true
+}
+
+// parsed leaves out the stored segments of the rows that couldn't be parsed.
+func (c sheetContents) parsed(entries []LWODEntry) []LWODEntry {
+	var parsed []LWODEntry
+	for _, e := range entries {
+		if !c.failed[e.WorksheetID][e.SheetRow] {
+			parsed = append(parsed, e)
+		}
+	}
+	return parsed
+}
+
+func (c sheetContents) add(worksheetID int64, platform lwodPlatform, id string) {
+	if c.vods[worksheetID] == nil {
+		c.vods[worksheetID] = make(map[string]bool)
+	}
+	c.vods[worksheetID][platform.Column+"\x00"+id] = true
+}
+
+func (c sheetContents) has(worksheetID int64, platform lwodPlatform, id string) bool {
+	return c.vods[worksheetID][platform.Column+"\x00"+id]
+}
+
+// reconcile marks the segments that came from the spreadsheet but whose VODs
+// aren't in their worksheet anymore as removed, along with the VODs that
+// have no segments left. Rows added before the provenance was stored can't
+// be reconciled, and the ones that couldn't be parsed this time aren't.
+func (r *lwodRun) reconcile(sheet LWODSheet, contents sheetContents) error {
+	db := r.config.LWODDBConfig.DB
+	platforms := lwodPlatforms(r.config, nil, nil, nil, nil, nil)
+
+	stored, err := r.segments("sheetid = ? AND removed_at IS NULL", sheet.ID)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the entries of spreadsheet %s", sheet.ID))
+	}
+	var removed []LWODEntry
+	// the VODs of the removed rows by platform
+	vods := make([]map[string]bool, len(platforms))
+	for _, e := range contents.parsed(stored) {
+		if contents.skipped[e.WorksheetID] {
+			continue
+		}
+
+		ids := e.vodIDs()
+		present := false
+		for i, platform := range platforms {
+			if ids[i] != "" && contents.has(e.WorksheetID, platform, ids[i]) {
+				present = true
+			}
+		}
+		if present {
+			continue
+		}
+		removed = append(removed, e)
+		for i := range platforms {
+			if ids[i] == "" {
+				continue
+			}
+			if vods[i] == nil {
+				vods[i] = make(map[string]bool)
+			}
+			vods[i][ids[i]] = true
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	if r.dryRun {
+		for _, e := range removed {
+			if !r.previewed(fmt.Sprintf("removed %d", e.id)) {
+				r.preview.removed++
+			}
+		}
+		fmt.Printf("Spreadsheet %s (\"%s\"): %d segment(s) no longer in it would be marked as removed\n", sheet.ID, sheet.Name, len(removed))
+		return nil
+	}
+
+	log.Infof(`[LWOD] Marking %d segment(s) no longer in spreadsheet %s ("%s") as removed`, len(removed), sheet.ID, sheet.Name)
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't begin the Tx")
+	}
+	now := time.Now().UTC()
+	for _, e := range removed {
+		if err := r.removeSegment(tx, e, now); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// the hash is cleared so the VOD gets synced again if it comes back
+	for i, platform := range platforms {
+		for id := range vods[i] {
+			_, err := tx.Exec(fmt.Sprintf("UPDATE %s SET removed_at = ?, hash = '' WHERE id = ? AND removed_at IS NULL AND NOT EXISTS (SELECT 1 FROM lwod WHERE %s = ? AND removed_at IS NULL)", platform.Table, platform.Column), now, id, id)
+			if err != nil {
+				tx.Rollback()
+				return WrapWithLWODError(err, fmt.Sprintf("Couldn't mark %s ID %s as removed", platform.Name, id))
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapWithLWODError(err, "Couldn't commit the Tx")
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package gsheets
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+	"google.golang.org/api/sheets/v4"
+)
+
+// how the go-sqlite3 driver stores the fetch times
+const snapshotTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// replayRun is the snapshots fetched by a single run.
+type replayRun struct {
+	id     string
+	sheets map[string]LWODSheet
+	// the snapshot hashes by spreadsheet ID
+	hashes map[string]string
+}
+
+// readSnapshot decompresses and decodes the snapshot, making sure its
+// contents still match the hash.
+func readSnapshot(dir, hash string) (*sheets.Spreadsheet, error) {
+	f, err := os.Open(snapshotPath(dir, hash))
+	if err != nil {
+		return nil, WrapWithLWODError(err, fmt.Sprintf("Couldn't open snapshot %s", hash))
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, WrapWithLWODError(err, fmt.Sprintf("Couldn't read snapshot %s", hash))
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, WrapWithLWODError(err, fmt.Sprintf("Couldn't read snapshot %s", hash))
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, WrapWithLWODError(fmt.Errorf("the contents don't match the hash"), fmt.Sprintf("Snapshot %s is corrupted", hash))
+	}
+
+	var file sheets.Spreadsheet
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, WrapWithLWODError(err, fmt.Sprintf("Couldn't decode snapshot %s", hash))
+	}
+
+	return &file, nil
+}
+
+// replayRuns reads the snapshots index, grouping the snapshots by the run
+// that fetched them, oldest run first. --sheet and --from/--to narrow down
+// which spreadsheets are included.
+func replayRuns(config *config.Config) ([]replayRun, error) {
+	start, end, err := monthRange(config.Flags.From, config.Flags.To)
+	if err != nil {
+		return nil, err
+	}
+	monthFilter := config.Flags.From != "" || config.Flags.To != ""
+
+	rows, err := config.SnapshotDBConfig.DB.Query("SELECT runid, fetched, sheetid, name, folder, sheetkey, modifiedtime, version, hash FROM snapshots ORDER BY fetched, id")
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Couldn't get the snapshots")
+	}
+	defer rows.Close()
+
+	var runs []replayRun
+	for rows.Next() {
+		var runID, fetched, key, hash string
+		var sheet LWODSheet
+		if err := rows.Scan(&runID, &fetched, &sheet.ID, &sheet.Name, &sheet.Folder, &key, &sheet.ModifiedTime, &sheet.Version, &hash); err != nil {
+			return nil, WrapWithLWODError(err, "Couldn't get the snapshots")
+		}
+		if month, err := time.Parse("2006-01", key); err == nil {
+			sheet.Year, sheet.Month = month.Year(), month.Month()
+		} else if t, err := time.Parse(snapshotTimeFormat, fetched); err == nil {
+			// the month window keys are relative to when the spreadsheet
+			// was fetched
+			for _, w := range monthWindow(t) {
+				if w.key == key {
+					sheet.Year, sheet.Month = w.date.Year(), w.date.Month()
+				}
+			}
+		}
+
+		if config.Flags.Sheet != "" && sheet.ID != config.Flags.Sheet {
+			continue
+		}
+		if monthFilter {
+			month := sheetDate{sheet.Year, sheet.Month}
+			if sheet.Month == 0 || month.time().Before(start) || month.time().After(end) {
+				continue
+			}
+		}
+
+		if len(runs) == 0 || runs[len(runs)-1].id != runID {
+			runs = append(runs, replayRun{
+				id:     runID,
+				sheets: make(map[string]LWODSheet),
+				hashes: make(map[string]string),
+			})
+		}
+		run := &runs[len(runs)-1]
+		run.sheets[key] = sheet
+		run.hashes[sheet.ID] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, WrapWithLWODError(err, "Couldn't get the snapshots")
+	}
+
+	return runs, nil
+}
+
+// ReplaySnapshots parses the spreadsheets in the snapshot store again, run
+// by run in the order they were fetched, the same way they were parsed when
+// they were fetched. Meant to be run into a fresh DB, so the results of
+// different versions of the parser can be compared.
+func ReplaySnapshots(config *config.Config) error {
+	runs, err := replayRuns(config)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		log.Infof("[LWOD] No snapshots to replay in %s", config.LWODSnapshotDir)
+		return nil
+	}
+
+	for i, run := range runs {
+		src := NewMemorySource()
+		for _, sheet := range run.sheets {
+			file, err := readSnapshot(config.LWODSnapshotDir, run.hashes[sheet.ID])
+			if err != nil {
+				return err
+			}
+			src.Spreadsheets[sheet.ID] = file
+		}
+
+		log.Infof("[LWOD] Replaying run %s (number %d/%d), %d spreadsheet(s)", run.id, i+1, len(runs), len(run.sheets))
+		if err := ParseSheets(src, run.sheets, config); err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't replay run %s", run.id))
+		}
+	}
+
+	return nil
+}
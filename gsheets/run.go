@@ -0,0 +1,212 @@
+package gsheets
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+)
+
+// ParseError is a problem with a single cell that, in lenient mode, got the
+// row skipped instead of aborting the run, what's stored for the row being
+// left as it is.
+type ParseError struct {
+	SheetID   string
+	Worksheet string
+	Row       int
+	Column    string
+	Value     string
+	Err       error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf(`spreadsheet %s, worksheet "%s", cell %s%d ("%s"): %v`, e.SheetID, e.Worksheet, e.Column, e.Row, e.Value, e.Err)
+}
+
+// lwodRun holds the state of a single pass over the LWOD spreadsheets.
+type lwodRun struct {
+	config  *config.Config
+	lenient bool
+	dryRun  bool
+	errors  []ParseError
+	// how many rows had their times flagged
+	flagged int
+	// how many VODs were hashed by an older version
+	rehashed int
+	games    *catalog
+	subjects *catalog
+	preview  struct {
+		vods, added, changed, removed int
+		// what's been counted already, a VOD on several platforms being
+		// previewed once for every one of them
+		seen map[string]bool
+	}
+
+	// the game names that couldn't be resolved, with how many rows have them
+	unresolvedGames map[string]int
+	// runID ties together the lwod_history rows of the run
+	runID string
+}
+
+func newLWODRun(config *config.Config) *lwodRun {
+	return &lwodRun{
+		config:  config,
+		lenient: config.Flags.Lenient || config.LWODLenient,
+		dryRun:  config.Flags.DryRun,
+
+		unresolvedGames: make(map[string]int),
+		runID:           time.Now().UTC().Format("20060102-150405.000000"),
+	}
+}
+
+// rowError records a problem with a cell, returning an error that aborts
+// the run unless it's in lenient mode.
+func (r *lwodRun) rowError(sheetID, worksheet string, row, col int, value string, err error, message string) error {
+	parseErr := ParseError{
+		SheetID:   sheetID,
+		Worksheet: worksheet,
+		Row:       row + 1,
+		Column:    columnName(col),
+		Value:     value,
+		Err:       err,
+	}
+
+	if !r.lenient {
+		return WrapWithLWODError(parseErr, message)
+	}
+
+	log.Debugf("[LWOD] %s, skipping: %s", message, parseErr)
+	r.errors = append(r.errors, parseErr)
+	if r.dryRun {
+		return nil
+	}
+	_, dbErr := r.config.LWODDBConfig.Statements.InsertParseErrorStmt.Exec(time.Now().UTC(), parseErr.SheetID, parseErr.Worksheet, parseErr.Row, parseErr.Column, parseErr.Value, parseErr.Err.Error())
+	if dbErr != nil {
+		return WrapWithLWODError(dbErr, "Couldn't insert entry into parse_errors")
+	}
+
+	return nil
+}
+
+// sheetUnchanged reports whether the spreadsheet's version is the same as
+// the last time it was parsed. Spreadsheets without a known version always
+// get parsed.
+func (r *lwodRun) sheetUnchanged(sheet LWODSheet) (bool, error) {
+	if sheet.Version == 0 || r.config.Flags.Force {
+		return false, nil
+	}
+
+	var version int64
+	err := r.config.LWODDBConfig.Statements.SelectSheetVersionStmt.QueryRow(sheet.ID).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, WrapWithLWODError(err, fmt.Sprintf("Sqlite error (sheet ID %s)", sheet.ID))
+	}
+
+	return version == sheet.Version, nil
+}
+
+// sheetParsed saves the metadata of a successfully parsed spreadsheet.
+func (r *lwodRun) sheetParsed(sheet LWODSheet) error {
+	if r.dryRun {
+		return nil
+	}
+
+	_, err := r.config.LWODDBConfig.Statements.UpsertSheetStmt.Exec(sheet.ID, sheet.Name, sheet.Folder, sheet.ModifiedTime, sheet.Version, time.Now().UTC())
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into sheets with sheet ID %s", sheet.ID))
+	}
+
+	return nil
+}
+
+// previewed marks the VOD or the segment with the key as counted in the
+// dry-run summary, reporting whether it had been already.
+func (r *lwodRun) previewed(key string) bool {
+	if r.preview.seen == nil {
+		r.preview.seen = make(map[string]bool)
+	}
+	seen := r.preview.seen[key]
+	r.preview.seen[key] = true
+	return seen
+}
+
+// resolveGame returns the ID of the canonical game, keeping track of the
+// ones that couldn't be resolved.
+func (r *lwodRun) resolveGame(name string) sql.NullInt64 {
+	if strings.TrimSpace(name) == "" || r.games == nil {
+		return sql.NullInt64{}
+	}
+
+	id := r.games.resolve(name)
+	if !id.Valid {
+		r.unresolvedGames[name]++
+	}
+	return id
+}
+
+// summarize logs how many problems were found in each worksheet and, in
+// dry-run mode, how much would've changed.
+func (r *lwodRun) summarize() {
+	if r.dryRun {
+		log.Infof("[LWOD] Dry run: %d VOD(s) would be updated, %d segment(s) added, %d changed, %d removed", r.preview.vods, r.preview.added, r.preview.changed, r.preview.removed)
+	}
+
+	if r.rehashed > 0 && !r.dryRun {
+		log.Infof("[LWOD] Synced %d VOD(s) hashed by an older version again", r.rehashed)
+	}
+
+	if len(r.unresolvedGames) > 0 {
+		log.Infof("[LWOD] %d game name(s) aren't aliases of any of the games, see lwod games", len(r.unresolvedGames))
+	}
+
+	if r.flagged > 0 {
+		log.Warnf("[LWOD] %d row(s) have a start/end time that couldn't be parsed or an end before the start, see the timeflag column", r.flagged)
+	}
+
+	if len(r.errors) == 0 {
+		return
+	}
+
+	type worksheetKey struct {
+		sheetID, worksheet string
+	}
+	var order []worksheetKey
+	counts := make(map[worksheetKey]int)
+	for _, e := range r.errors {
+		key := worksheetKey{e.SheetID, e.Worksheet}
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+
+	if r.dryRun {
+		log.Warnf("[LWOD] Found %d malformed cell(s):", len(r.errors))
+	} else {
+		log.Warnf("[LWOD] Skipped %d malformed cell(s), see the parse_errors table for details:", len(r.errors))
+	}
+	for _, key := range order {
+		log.Warnf(`[LWOD] - spreadsheet %s, worksheet "%s": %d`, key.sheetID, key.worksheet, counts[key])
+	}
+}
+
+// columnName turns a 0-based column index into its letters ("A", "B", ...,
+// "AA", ...).
+func columnName(col int) string {
+	if col < 0 {
+		return ""
+	}
+
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,104 @@
+package gsheets
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vyneer/lwodcollector/config"
+)
+
+// SearchResult is an LWOD segment matching a search, along with links to it.
+type SearchResult struct {
+	Date, Start, End, Game, Subject, Topic string
+	Links                                  []VODLink
+}
+
+// Search looks the query up in the topics, subjects and games of the LWOD
+// segments, best matches first. The query uses the FTS5 syntax, and if it
+// can't be run as FTS5 its words are searched for as they are.
+func Search(config *config.Config, query string, limit int) ([]SearchResult, error) {
+	if !config.LWODDBConfig.FTS {
+		return nil, errors.New("SQLite was built without FTS5, rebuild lwodcollector with -tags sqlite_fts5")
+	}
+
+	results, err := search(config.LWODDBConfig.DB, query, limit)
+	if err != nil {
+		results, err = search(config.LWODDBConfig.DB, quoteFTSQuery(query), limit)
+	}
+	if err != nil {
+		return nil, WrapWithLWODError(err, fmt.Sprintf(`Couldn't search for "%s"`, query))
+	}
+
+	return results, nil
+}
+
+func search(db *sql.DB, query string, limit int) ([]SearchResult, error) {
+	rows, err := db.Query(`SELECT l.datestreamed, l.starttime, l.endtime, l.game, l.subject, l.topic,
+		l.vidid, l.yttime, l.vodid, l.twitchtime, l.rumbleid, l.rumbletime, l.kickid, l.kicktime, l.odyseeid, l.odyseetime
+		FROM lwod_fts JOIN lwod l ON l.id = lwod_fts.rowid
+		WHERE lwod_fts MATCH ? AND l.removed_at IS NULL ORDER BY rank LIMIT ?`, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var date, start, end, game, subject, topic sql.NullString
+		var ids [5]sql.NullString
+		var stamps [5]sql.NullInt64
+		err := rows.Scan(&date, &start, &end, &game, &subject, &topic,
+			&ids[0], &stamps[0], &ids[1], &stamps[1], &ids[2], &stamps[2], &ids[3], &stamps[3], &ids[4], &stamps[4])
+		if err != nil {
+			return nil, err
+		}
+		result.Date, result.Start, result.End = date.String, start.String, end.String
+		result.Game, result.Subject, result.Topic = game.String, subject.String, topic.String
+		for i, platform := range []string{PlatformYouTube, PlatformTwitch, PlatformRumble, PlatformKick, PlatformOdysee} {
+			if ids[i].String != "" {
+				result.Links = append(result.Links, VODLink{
+					Platform: platform,
+					ID:       ids[i].String,
+					Offset:   int(stamps[i].Int64),
+				})
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// quoteFTSQuery turns every word of the query into an FTS5 string, so
+// "chat-gpt" (the "gpt" column of "chat") or "don't" can be searched for.
+func quoteFTSQuery(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// PrintSearch prints the results of Search.
+func PrintSearch(config *config.Config, query string, limit int) error {
+	results, err := Search(config, query, limit)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		fmt.Printf("%s  %s-%s  %s | %s\n", result.Date, result.Start, result.End, result.Game, result.Subject)
+		fmt.Printf("    %s\n", result.Topic)
+		for _, link := range result.Links {
+			fmt.Printf("    %s\n", link.URL())
+		}
+	}
+	if len(results) == 0 {
+		fmt.Println("No results")
+	}
+
+	return nil
+}
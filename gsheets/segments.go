@@ -0,0 +1,198 @@
+package gsheets
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	log "github.com/vyneer/lwodcollector/logger"
+	"google.golang.org/api/sheets/v4"
+)
+
+// changedVOD is a VOD of a worksheet whose hash doesn't match the stored one.
+type changedVOD struct {
+	platform lwodPlatform
+	id, hash string
+	entries  []LWODEntry
+}
+
+// syncVODs makes the stored segments of the changed VODs match the
+// worksheet. The segments are paired up the same way a dry run does it, so
+// the ones that are still there keep their IDs and dateadded - only the
+// changed ones get updated, the new ones inserted and the missing ones marked
+// as removed.
+func (r *lwodRun) syncVODs(vods []changedVOD, sheet LWODSheet, ws *sheets.Sheet, contents sheetContents) error {
+	var old, new []LWODEntry
+	var games []string
+	storedIDs := make(map[int64]bool)
+	rows := make(map[int]bool)
+	seenGames := make(map[string]bool)
+	for _, vod := range vods {
+		stored, err := r.storedSegments(vod.platform, vod.id, sheet.ID, ws.Properties.SheetId)
+		if err != nil {
+			return err
+		}
+		// rows with links to several platforms show up in several VODs
+		for _, e := range contents.parsed(stored) {
+			if !storedIDs[e.id] {
+				storedIDs[e.id] = true
+				old = append(old, e)
+			}
+		}
+		for _, e := range vod.entries {
+			if !rows[e.row] {
+				rows[e.row] = true
+				new = append(new, e)
+			}
+			if e.Game != "" && !seenGames[e.Game] {
+				seenGames[e.Game] = true
+				games = append(games, e.Game)
+			}
+		}
+	}
+	diff := diffSegments(old, new)
+	log.Debugf(`[LWOD] Syncing %d VOD(s) of worksheet "%s": %d added, %d changed, %d removed`, len(vods), ws.Properties.Title, len(diff.Added), len(diff.Changed), len(diff.Removed))
+
+	tx, err := r.config.LWODDBConfig.DB.Begin()
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf(`Couldn't begin the Tx (spreadsheet %s: "%s", worksheet "%s")`, sheet.ID, sheet.Name, ws.Properties.Title))
+	}
+
+	// the lwod rows reference the VODs, so they go first
+	for _, vod := range vods {
+		_, err := tx.Stmt(vod.platform.upsert).Exec(vod.id, vod.hash)
+		if err != nil {
+			tx.Rollback()
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't upsert entry with %s ID %s", vod.platform.Name, vod.id))
+		}
+	}
+	now := time.Now().UTC()
+	for _, e := range diff.Removed {
+		if err := r.removeSegment(tx, e, now); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, pair := range diff.Changed {
+		if err := r.updateSegment(tx, pair[0], pair[1]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, e := range diff.Added {
+		if err := r.insertSegment(tx, e); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// the segments that didn't change might've been added before an alias of
+	// their game was
+	if r.games != nil {
+		if err := resolveGames(tx, r.games, games); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapWithLWODError(err, "Couldn't commit the Tx")
+	}
+	return nil
+}
+
+func (r *lwodRun) insertSegment(tx *sql.Tx, entry LWODEntry) error {
+	res, err := tx.Exec(
+		"INSERT INTO lwod (dateadded, datestreamed, vodid, vidid, rumbleid, kickid, odyseeid, starttime, endtime, yttime, twitchtime, rumbletime, kicktime, odyseetime, game, subject, topic, startseconds, endseconds, duration, timeflag, gameid, sheetid, worksheetid, sheetrow, cellurl) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		append([]any{entry.DateAdded}, segmentValues(entry)...)...,
+	)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry %+v", entry))
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't get the ID of entry %+v", entry))
+	}
+	if err := r.recordHistory(tx, id, historyInsert, nil, &entry); err != nil {
+		return err
+	}
+
+	return r.linkSegment(tx, id, entry)
+}
+
+// updateSegment rewrites everything about the lwod row but its dateadded.
+func (r *lwodRun) updateSegment(tx *sql.Tx, old, entry LWODEntry) error {
+	id := old.id
+	_, err := tx.Exec(
+		"UPDATE lwod SET datestreamed = ?, vodid = ?, vidid = ?, rumbleid = ?, kickid = ?, odyseeid = ?, starttime = ?, endtime = ?, yttime = ?, twitchtime = ?, rumbletime = ?, kicktime = ?, odyseetime = ?, game = ?, subject = ?, topic = ?, startseconds = ?, endseconds = ?, duration = ?, timeflag = ?, gameid = ?, sheetid = ?, worksheetid = ?, sheetrow = ?, cellurl = ? WHERE id = ?",
+		append(segmentValues(entry), id)...,
+	)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't update entry %d to %+v", id, entry))
+	}
+	if _, err := tx.Exec("DELETE FROM lwod_notes WHERE lwodid = ?", id); err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete the notes of entry %d", id))
+	}
+	if _, err := tx.Exec("DELETE FROM lwod_subjects WHERE lwodid = ?", id); err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete the subjects of entry %d", id))
+	}
+	if err := r.recordHistory(tx, id, historyUpdate, &old, &entry); err != nil {
+		return err
+	}
+
+	return r.linkSegment(tx, id, entry)
+}
+
+// removeSegment soft-deletes the lwod row.
+func (r *lwodRun) removeSegment(tx *sql.Tx, entry LWODEntry, now time.Time) error {
+	if _, err := tx.Exec("UPDATE lwod SET removed_at = ? WHERE id = ?", now, entry.id); err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't mark entry %d as removed", entry.id))
+	}
+	return r.recordHistory(tx, entry.id, historyRemove, &entry, nil)
+}
+
+// segmentValues are the values of the lwod columns from datestreamed on.
+func segmentValues(entry LWODEntry) []any {
+	return []any{
+		entry.DateStreamed,
+		newNullString(entry.Twitch),
+		newNullString(entry.YouTube),
+		newNullString(entry.Rumble),
+		newNullString(entry.Kick),
+		newNullString(entry.Odysee),
+		entry.Start,
+		entry.End,
+		entry.YouTubeStamp,
+		entry.TwitchStamp,
+		entry.RumbleStamp,
+		entry.KickStamp,
+		entry.OdyseeStamp,
+		entry.Game,
+		entry.Subject,
+		entry.Topic,
+		entry.StartSeconds,
+		entry.EndSeconds,
+		entry.Duration,
+		newNullString(entry.TimeFlag),
+		entry.GameID,
+		entry.SheetID,
+		entry.WorksheetID,
+		entry.SheetRow,
+		newNullString(entry.CellURL),
+	}
+}
+
+// linkSegment adds the notes and the subjects of the lwod row.
+func (r *lwodRun) linkSegment(tx *sql.Tx, id int64, entry LWODEntry) error {
+	for _, note := range entry.Notes {
+		_, err := tx.Exec("INSERT INTO lwod_notes (lwodid, field, note) VALUES (?, ?, ?)", id, note.Field, note.Note)
+		if err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert note %+v of entry %+v", note, entry))
+		}
+	}
+	if r.subjects != nil {
+		if err := linkSubjects(tx, r.subjects, id, entry.Subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
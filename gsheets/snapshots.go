@@ -0,0 +1,202 @@
+package gsheets
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/vyneer/lwodcollector/logger"
+	"google.golang.org/api/sheets/v4"
+)
+
+// snapshot is a spreadsheet archived in the snapshot store.
+type snapshot struct {
+	// hash is the SHA-256 of the JSON, which is also the name of its file
+	hash    string
+	size    int
+	fetched time.Time
+}
+
+// spreadsheetJSON returns the spreadsheet as the source's raw JSON if it has
+// it, marshaling the parsed spreadsheet otherwise.
+func spreadsheetJSON(src SheetSource, id string) ([]byte, error) {
+	if raw, ok := src.(RawSheetSource); ok {
+		return raw.GetSpreadsheetJSON(id)
+	}
+
+	file, err := src.GetSpreadsheet(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return nil, WrapWithLWODError(err, fmt.Sprintf("Couldn't encode spreadsheet %s", id))
+	}
+
+	return data, nil
+}
+
+// snapshotPath is where the snapshot with the hash is kept, the files being
+// spread over subdirectories by the first byte of the hash.
+func snapshotPath(dir, hash string) string {
+	return filepath.Join(dir, hash[:2], hash+".json.gz")
+}
+
+// writeSnapshot gzips the JSON into the store, unless a snapshot with the
+// same contents is already there.
+func writeSnapshot(dir string, data []byte) (snapshot, error) {
+	sum := sha256.Sum256(data)
+	snap := snapshot{
+		hash:    hex.EncodeToString(sum[:]),
+		size:    len(data),
+		fetched: time.Now().UTC(),
+	}
+
+	path := snapshotPath(dir, snap.hash)
+	if _, err := os.Stat(path); err == nil {
+		return snap, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return snapshot{}, WrapWithLWODError(err, "Couldn't create the snapshot directory")
+	}
+
+	// written to a temporary file first, so a snapshot is never left half done
+	tmp, err := os.CreateTemp(filepath.Dir(path), snap.hash+".*.tmp")
+	if err != nil {
+		return snapshot{}, WrapWithLWODError(err, fmt.Sprintf("Couldn't create snapshot %s", snap.hash))
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if _, err := zw.Write(data); err != nil {
+		tmp.Close()
+		return snapshot{}, WrapWithLWODError(err, fmt.Sprintf("Couldn't write snapshot %s", snap.hash))
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return snapshot{}, WrapWithLWODError(err, fmt.Sprintf("Couldn't write snapshot %s", snap.hash))
+	}
+	if err := tmp.Close(); err != nil {
+		return snapshot{}, WrapWithLWODError(err, fmt.Sprintf("Couldn't write snapshot %s", snap.hash))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return snapshot{}, WrapWithLWODError(err, fmt.Sprintf("Couldn't write snapshot %s", snap.hash))
+	}
+
+	return snap, nil
+}
+
+// archiving reports whether the fetched spreadsheets go to the snapshot
+// store. Dry runs don't write to it, and replays only read from it.
+func (r *lwodRun) archiving() bool {
+	return r.config.SnapshotDBConfig.DB != nil && !r.dryRun && r.config.Flags.Snapshots == ""
+}
+
+// fetchSpreadsheet gets the spreadsheet from the source, archiving the JSON
+// it came as first if LWOD_SNAPSHOT_DIR is set. Local exports aren't
+// archived.
+func (r *lwodRun) fetchSpreadsheet(src SheetSource, sheet LWODSheet) (*sheets.Spreadsheet, *snapshot, error) {
+	if !r.archiving() || sheet.Local {
+		file, err := src.GetSpreadsheet(sheet.ID)
+		return file, nil, err
+	}
+
+	data, err := spreadsheetJSON(src, sheet.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	snap, err := writeSnapshot(r.config.LWODSnapshotDir, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var file sheets.Spreadsheet
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, WrapWithLWODError(err, fmt.Sprintf("Couldn't decode spreadsheet %s", sheet.ID))
+	}
+
+	return &file, &snap, nil
+}
+
+// indexSnapshot adds the snapshot to the snapshots table.
+func (r *lwodRun) indexSnapshot(sheetKey string, sheet LWODSheet, snap snapshot) error {
+	_, err := r.config.SnapshotDBConfig.Statements.InsertSnapshotStmt.Exec(r.runID, snap.fetched, sheet.ID, sheet.Name, sheet.Folder, sheetKey, sheet.ModifiedTime, sheet.Version, snap.hash, snap.size)
+	if err != nil {
+		return WrapWithLWODError(err, fmt.Sprintf("Couldn't insert entry into snapshots with sheet ID %s", sheet.ID))
+	}
+	log.Debugf(`[LWOD] Archived sheet ID %s (name: "%s") as snapshot %s`, sheet.ID, sheet.Name, snap.hash)
+
+	return nil
+}
+
+// pruneSnapshots drops the snapshots older than LWOD_SNAPSHOT_RETENTION_DAYS,
+// except for the latest LWOD_SNAPSHOT_KEEP of every spreadsheet, deleting
+// the files no snapshot is left pointing to.
+func (r *lwodRun) pruneSnapshots() error {
+	if !r.archiving() || r.config.LWODSnapshotRetention <= 0 {
+		return nil
+	}
+
+	db := r.config.SnapshotDBConfig.DB
+	cutoff := time.Now().UTC().AddDate(0, 0, -r.config.LWODSnapshotRetention)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't begin the Tx")
+	}
+	rows, err := tx.Query("DELETE FROM snapshots WHERE fetched < ? AND id NOT IN (SELECT id FROM (SELECT id, row_number() OVER (PARTITION BY sheetid ORDER BY fetched DESC, id DESC) AS n FROM snapshots) WHERE n <= ?) RETURNING hash", cutoff, r.config.LWODSnapshotKeep)
+	if err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, "Couldn't prune the snapshots")
+	}
+	pruned := 0
+	hashes := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return WrapWithLWODError(err, "Couldn't prune the snapshots")
+		}
+		hashes[hash] = true
+		pruned++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, "Couldn't prune the snapshots")
+	}
+
+	// the same contents can be in several snapshots
+	var orphans []string
+	for hash := range hashes {
+		var used bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM snapshots WHERE hash = ?)", hash).Scan(&used); err != nil {
+			tx.Rollback()
+			return WrapWithLWODError(err, "Couldn't prune the snapshots")
+		}
+		if !used {
+			orphans = append(orphans, hash)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return WrapWithLWODError(err, "Couldn't commit the Tx")
+	}
+
+	for _, hash := range orphans {
+		if err := os.Remove(snapshotPath(r.config.LWODSnapshotDir, hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't delete snapshot %s", hash))
+		}
+	}
+	if pruned > 0 {
+		log.Infof("[LWOD] Pruned %d snapshot(s) older than %d day(s), deleted %d file(s)", pruned, r.config.LWODSnapshotRetention, len(orphans))
+	}
+
+	return nil
+}
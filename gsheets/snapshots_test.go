@@ -0,0 +1,123 @@
+package gsheets
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+)
+
+// lwodRows returns the segments that aren't removed, with what they came
+// from and what they say.
+func lwodRows(t *testing.T, db *sql.DB) [][]string {
+	t.Helper()
+	rows, err := db.Query("SELECT datestreamed, coalesce(vidid, ''), coalesce(vodid, ''), starttime, endtime, game, subject, topic, sheetid, worksheetid, sheetrow FROM lwod WHERE removed_at IS NULL ORDER BY sheetid, worksheetid, sheetrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var result [][]string
+	for rows.Next() {
+		row := make([]string, 11)
+		values := make([]any, len(row))
+		for i := range row {
+			values[i] = &row[i]
+		}
+		if err := rows.Scan(values...); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSnapshotsReplay(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LWODSnapshotDir = "snapshots"
+	cfg.LWODSnapshotRetention = 1
+	cfg.LWODSnapshotKeep = 1
+	config.LoadSnapshotDatabase(cfg)
+	t.Cleanup(func() {
+		cfg.SnapshotDBConfig.DB.Close()
+	})
+	snapshots := cfg.SnapshotDBConfig.DB
+
+	versions := [][][]string{
+		{
+			{"04/03/23", "0:00", "1:00", "Chess", "Destiny", "first", "https://youtu.be/dQw4w9WgXcQ?t=10", ""},
+			{"05/03/23", "0:00", "1:00", "Chess", "Destiny, Vaush", "second", "https://youtu.be/aaaaaaaaaaa", "https://www.twitch.tv/videos/1234567890"},
+		},
+		// the topic of the first row is fixed and a row is added
+		{
+			{"04/03/23", "0:00", "1:00", "Chess", "Destiny", "first, fixed", "https://youtu.be/dQw4w9WgXcQ?t=10", ""},
+			{"05/03/23", "0:00", "1:00", "Chess", "Destiny, Vaush", "second", "https://youtu.be/aaaaaaaaaaa", "https://www.twitch.tv/videos/1234567890"},
+			{"05/03/23", "1:00", "2:00", "", "Destiny", "third", "https://youtu.be/aaaaaaaaaaa?t=3600", ""},
+		},
+	}
+	var firstHash string
+	for i, rows := range versions {
+		src := NewMemorySource()
+		src.AddSpreadsheet("root", "2023-03", testSpreadsheet("SHEET1", append([][]string{testHeader}, rows...)...))
+		lwod := map[string]LWODSheet{"2023-03": {ID: "SHEET1", Name: "2023-03", Version: int64(i + 1), Year: 2023, Month: 3}}
+		if err := ParseSheets(src, lwod, cfg); err != nil {
+			t.Fatal(err)
+		}
+
+		// the first snapshot gets old enough to be pruned by the second run
+		if i == 0 {
+			if err := snapshots.QueryRow("SELECT hash FROM snapshots").Scan(&firstHash); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := snapshots.Exec("UPDATE snapshots SET fetched = ?", time.Now().UTC().AddDate(0, 0, -2)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var count int
+	if err := snapshots.QueryRow("SELECT count(*) FROM snapshots").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d snapshot(s) are left after pruning, want 1", count)
+	}
+	if _, err := os.Stat(snapshotPath(cfg.LWODSnapshotDir, firstHash)); !os.IsNotExist(err) {
+		t.Errorf("the file of the pruned snapshot is still there: %v", err)
+	}
+
+	replay := &config.Config{
+		LWODSnapshotDir: cfg.LWODSnapshotDir,
+		Flags:           config.Flags{Snapshots: cfg.LWODSnapshotDir, DB: "replay.db"},
+	}
+	config.LoadLWODDatabase(replay)
+	t.Cleanup(func() {
+		replay.LWODDBConfig.DB.Close()
+		replay.SnapshotDBConfig.DB.Close()
+	})
+	if err := ReplaySnapshots(replay); err != nil {
+		t.Fatal(err)
+	}
+
+	want := lwodRows(t, cfg.LWODDBConfig.DB)
+	if len(want) != 3 {
+		t.Fatalf("the original DB has %d segment(s), want 3", len(want))
+	}
+	if got := lwodRows(t, replay.LWODDBConfig.DB); !reflect.DeepEqual(got, want) {
+		t.Errorf("the replayed DB has %q, want %q", got, want)
+	}
+
+	// replays don't add to the store
+	if err := snapshots.QueryRow("SELECT count(*) FROM snapshots").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("the replay left %d snapshot(s), want 1", count)
+	}
+}
@@ -0,0 +1,196 @@
+package gsheets
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/vyneer/lwodcollector/config"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	mimeFolder      = "application/vnd.google-apps.folder"
+	mimeSpreadsheet = "application/vnd.google-apps.spreadsheet"
+
+	// the parts of a spreadsheet the parser needs
+	spreadsheetFields = "spreadsheetId,properties.title,sheets(properties,data.rowData.values(userEnteredValue,effectiveValue,formattedValue,note,hyperlink,textFormatRuns))"
+)
+
+// SheetFile is a file or a folder inside the LWOD folder tree.
+type SheetFile struct {
+	ID       string
+	Name     string
+	MimeType string
+	Parents  []string
+
+	ModifiedTime string
+	// Version is the Drive version of the file, it goes up with every change
+	Version int64
+}
+
+// SheetSource is where CollectSheets and ParseSheets get the LWOD
+// spreadsheets from.
+type SheetSource interface {
+	// ListFiles returns the files and folders directly inside the parent folder.
+	ListFiles(parentID string) ([]SheetFile, error)
+	// GetFile returns a single file by its ID.
+	GetFile(id string) (SheetFile, error)
+	// GetSpreadsheet returns the spreadsheet with all of its worksheets and
+	// their rows of cells.
+	GetSpreadsheet(id string) (*sheets.Spreadsheet, error)
+}
+
+// RawSheetSource is a SheetSource that can also return the spreadsheets as
+// the exact JSON the Sheets API responded with, for the snapshot store.
+type RawSheetSource interface {
+	SheetSource
+	GetSpreadsheetJSON(id string) ([]byte, error)
+}
+
+// DriveSource is the default SheetSource, backed by the Drive and Sheets APIs.
+type DriveSource struct {
+	config *config.Config
+}
+
+func NewDriveSource(config *config.Config) *DriveSource {
+	return &DriveSource{
+		config: config,
+	}
+}
+
+func (s *DriveSource) ListFiles(parentID string) ([]SheetFile, error) {
+	result, err := s.config.GoogleConfig.Drive.Files.List().Q(fmt.Sprintf(`"%s" in parents`, parentID)).Fields("files(*)").Do()
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Drive error")
+	}
+
+	files := make([]SheetFile, 0, len(result.Files))
+	for _, f := range result.Files {
+		files = append(files, SheetFile{
+			ID:       f.Id,
+			Name:     f.Name,
+			MimeType: f.MimeType,
+			Parents:  f.Parents,
+
+			ModifiedTime: f.ModifiedTime,
+			Version:      f.Version,
+		})
+	}
+
+	return files, nil
+}
+
+func (s *DriveSource) GetFile(id string) (SheetFile, error) {
+	f, err := s.config.GoogleConfig.Drive.Files.Get(id).Fields("id,name,mimeType,parents,modifiedTime,version").Do()
+	if err != nil {
+		return SheetFile{}, WrapWithLWODError(err, "Drive error")
+	}
+
+	return SheetFile{
+		ID:       f.Id,
+		Name:     f.Name,
+		MimeType: f.MimeType,
+		Parents:  f.Parents,
+
+		ModifiedTime: f.ModifiedTime,
+		Version:      f.Version,
+	}, nil
+}
+
+func (s *DriveSource) GetSpreadsheet(id string) (*sheets.Spreadsheet, error) {
+	file, err := s.config.GoogleConfig.Sheets.Spreadsheets.Get(id).Fields(spreadsheetFields).Do()
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Sheets error")
+	}
+
+	return file, nil
+}
+
+// GetSpreadsheetJSON makes the same request as GetSpreadsheet, but returns
+// the response body as it is.
+func (s *DriveSource) GetSpreadsheetJSON(id string) ([]byte, error) {
+	params := url.Values{}
+	params.Set("fields", spreadsheetFields)
+	params.Set("alt", "json")
+	params.Set("prettyPrint", "false")
+	u := fmt.Sprintf("%sv4/spreadsheets/%s?%s", s.config.GoogleConfig.Sheets.BasePath, url.PathEscape(id), params.Encode())
+
+	res, err := s.config.GoogleConfig.HTTP.Get(u)
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Sheets error")
+	}
+	defer res.Body.Close()
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, WrapWithLWODError(err, "Sheets error")
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, WrapWithLWODError(err, "Sheets error")
+	}
+
+	return body, nil
+}
+
+// MemorySource is a SheetSource that keeps everything in memory, used for
+// local imports and for running the LWOD pipeline without network access.
+type MemorySource struct {
+	Files        map[string][]SheetFile
+	Spreadsheets map[string]*sheets.Spreadsheet
+}
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		Files:        make(map[string][]SheetFile),
+		Spreadsheets: make(map[string]*sheets.Spreadsheet),
+	}
+}
+
+// AddFolder adds an empty folder with the given ID to the parent folder.
+func (s *MemorySource) AddFolder(parentID, id, name string) {
+	s.Files[parentID] = append(s.Files[parentID], SheetFile{
+		ID:       id,
+		Name:     name,
+		MimeType: mimeFolder,
+		Parents:  []string{parentID},
+	})
+}
+
+// AddSpreadsheet adds the spreadsheet to the parent folder, using its
+// SpreadsheetId as the file ID.
+func (s *MemorySource) AddSpreadsheet(parentID, name string, file *sheets.Spreadsheet) {
+	s.Files[parentID] = append(s.Files[parentID], SheetFile{
+		ID:       file.SpreadsheetId,
+		Name:     name,
+		MimeType: mimeSpreadsheet,
+		Parents:  []string{parentID},
+	})
+	s.Spreadsheets[file.SpreadsheetId] = file
+}
+
+func (s *MemorySource) ListFiles(parentID string) ([]SheetFile, error) {
+	return s.Files[parentID], nil
+}
+
+func (s *MemorySource) GetFile(id string) (SheetFile, error) {
+	for _, files := range s.Files {
+		for _, f := range files {
+			if f.ID == id {
+				return f, nil
+			}
+		}
+	}
+
+	return SheetFile{}, WrapWithLWODError(fmt.Errorf("file %s not found", id), "Drive error")
+}
+
+func (s *MemorySource) GetSpreadsheet(id string) (*sheets.Spreadsheet, error) {
+	file, ok := s.Spreadsheets[id]
+	if !ok {
+		return nil, WrapWithLWODError(fmt.Errorf("spreadsheet %s not found", id), "Sheets error")
+	}
+
+	return file, nil
+}
@@ -0,0 +1,182 @@
+package gsheets
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+)
+
+// the lwod_state key of the hash of the subject aliases lwod_subjects was
+// last built with
+const stateSubjectsHash = "subjects_hash"
+
+// subjectSeparatorRegex splits "Destiny, Vaush & Hasan" or "Destiny vs Vaush"
+// into the people/channels. Slashes, "and", "with" etc. are part of too many
+// names ("r/LivestreamFail", "Ethan and Hila Klein") to split on.
+var subjectSeparatorRegex = regexp.MustCompile(`(?i)\s*(?:[,;&\n]|\svs\.?\s)\s*`)
+
+// bump to rebuild lwod_subjects after changing how subjects are split
+const subjectSplitVersion = "2"
+
+func newSubjectsCatalog() *catalog {
+	return &catalog{
+		Name:       "subject",
+		Table:      "subjects",
+		AliasTable: "subject_aliases",
+		IDColumn:   "subjectid",
+	}
+}
+
+// splitSubjects splits the subject column into the people/channels in it,
+// dropping the empty and duplicate ones.
+func splitSubjects(subject string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range subjectSeparatorRegex.Split(subject, -1) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[normalizeName(name)] {
+			continue
+		}
+		seen[normalizeName(name)] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// linkSubjects resolves the entry's subjects, adding the new ones, and links
+// them to the lwod row.
+func linkSubjects(tx *sql.Tx, subjects *catalog, lwodID int64, subject string) error {
+	for _, name := range splitSubjects(subject) {
+		id, err := subjects.add(tx, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO lwod_subjects (lwodid, subjectid) VALUES (?, ?) ON CONFLICT DO NOTHING", lwodID, id)
+		if err != nil {
+			return WrapWithLWODError(err, fmt.Sprintf(`Couldn't link subject "%s" to entry %d`, name, lwodID))
+		}
+	}
+	return nil
+}
+
+// syncSubjects seeds the subjects from LWOD_SUBJECTS, if it's set, and
+// rebuilds lwod_subjects if the aliases changed since it was last built. With
+// write set to false it only reads the subjects.
+func syncSubjects(config *config.Config, write bool) (*catalog, error) {
+	db := config.LWODDBConfig.DB
+	subjects := newSubjectsCatalog()
+
+	if write && config.LWODSubjects != nil {
+		if err := subjects.seed(db, config.LWODSubjects); err != nil {
+			return nil, err
+		}
+	}
+	if err := subjects.load(db); err != nil {
+		return nil, err
+	}
+	hash := subjects.hash()
+	if err := subjects.loadNames(db); err != nil {
+		return nil, err
+	}
+	if !write {
+		return subjects, nil
+	}
+
+	var oldHash string
+	err := config.LWODDBConfig.Statements.SelectStateStmt.QueryRow(stateSubjectsHash).Scan(&oldHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, WrapWithLWODError(err, "Couldn't get the subjects hash")
+	}
+	if oldHash == hash {
+		return subjects, nil
+	}
+
+	log.Infof("[LWOD] The subject aliases changed, rebuilding lwod_subjects")
+	if err := rebuildSubjects(config, subjects, hash); err != nil {
+		return nil, err
+	}
+
+	// the rebuild drops the subjects nothing uses anymore
+	if err := subjects.load(db); err != nil {
+		return nil, err
+	}
+	if err := subjects.loadNames(db); err != nil {
+		return nil, err
+	}
+
+	return subjects, nil
+}
+
+// hash covers the aliases and the way subjects are split, which is all that
+// decides what lwod_subjects looks like (and, for the games, their gameid).
+func (c *catalog) hash() string {
+	aliases := make([]string, 0, len(c.ids))
+	for alias, id := range c.ids {
+		aliases = append(aliases, alias+"="+strconv.FormatInt(id, 10))
+	}
+	sort.Strings(aliases)
+	return strconv.FormatUint(xxhash.Sum64String(subjectSplitVersion+"\n"+strings.Join(aliases, "\n")), 10)
+}
+
+func rebuildSubjects(config *config.Config, subjects *catalog, hash string) error {
+	tx, err := config.LWODDBConfig.DB.Begin()
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't begin the Tx")
+	}
+
+	type row struct {
+		id      int64
+		subject string
+	}
+	var rows []row
+	result, err := tx.Query("SELECT id, subject FROM lwod WHERE subject != ''")
+	if err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, "Couldn't get the subjects in the lwod table")
+	}
+	for result.Next() {
+		var r row
+		if err := result.Scan(&r.id, &r.subject); err != nil {
+			result.Close()
+			tx.Rollback()
+			return WrapWithLWODError(err, "Couldn't get the subjects in the lwod table")
+		}
+		rows = append(rows, r)
+	}
+	result.Close()
+	if err := result.Err(); err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, "Couldn't get the subjects in the lwod table")
+	}
+
+	if _, err := tx.Exec("DELETE FROM lwod_subjects"); err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, "Couldn't clear lwod_subjects")
+	}
+	for _, r := range rows {
+		if err := linkSubjects(tx, subjects, r.id, r.subject); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	// subjects that were added as they are, but are aliases of others now
+	_, err = tx.Exec("DELETE FROM subjects WHERE id NOT IN (SELECT subjectid FROM lwod_subjects) AND id NOT IN (SELECT subjectid FROM subject_aliases)")
+	if err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, "Couldn't delete the unused subjects")
+	}
+	if _, err := tx.Stmt(config.LWODDBConfig.Statements.UpsertStateStmt).Exec(stateSubjectsHash, hash); err != nil {
+		tx.Rollback()
+		return WrapWithLWODError(err, "Couldn't save the subjects hash")
+	}
+
+	return tx.Commit()
+}
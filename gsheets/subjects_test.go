@@ -0,0 +1,40 @@
+package gsheets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSubjects(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    []string
+	}{
+		{"Destiny", []string{"Destiny"}},
+		{"Destiny, Vaush & Hasan", []string{"Destiny", "Vaush", "Hasan"}},
+		{"Destiny,Vaush", []string{"Destiny", "Vaush"}},
+		{"Destiny; Lonerbox", []string{"Destiny", "Lonerbox"}},
+		{"Destiny\nPisco", []string{"Destiny", "Pisco"}},
+		{"Destiny vs Vaush", []string{"Destiny", "Vaush"}},
+		{"Destiny VS. Nick Fuentes", []string{"Destiny", "Nick Fuentes"}},
+		{"Destiny & Melina vs Sneako", []string{"Destiny", "Melina", "Sneako"}},
+		// duplicates and empty names are dropped
+		{"Destiny, destiny,, Vaush", []string{"Destiny", "Vaush"}},
+		{" , ", nil},
+		{"", nil},
+
+		// the separators that are part of names
+		{"Ethan and Hila Klein", []string{"Ethan and Hila Klein"}},
+		{"r/LivestreamFail", []string{"r/LivestreamFail"}},
+		{"Destiny with Chat", []string{"Destiny with Chat"}},
+		{"Mr. Girl", []string{"Mr. Girl"}},
+		// "vs" without spaces around it
+		{"Destiny vsVaush", []string{"Destiny vsVaush"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitSubjects(tt.subject); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSubjects(%q) = %q, want %q", tt.subject, got, tt.want)
+		}
+	}
+}
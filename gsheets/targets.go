@@ -0,0 +1,78 @@
+package gsheets
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vyneer/lwodcollector/config"
+	log "github.com/vyneer/lwodcollector/logger"
+)
+
+// monthRange parses the --from and --to flags, either of which can be empty
+// to leave that side of the range open.
+func monthRange(from, to string) (time.Time, time.Time, error) {
+	start, end := time.Time{}, time.Date(9999, 12, 1, 0, 0, 0, 0, time.UTC)
+	var err error
+	if from != "" {
+		start, err = time.Parse("2006-01", from)
+		if err != nil {
+			return start, end, WrapWithLWODError(err, fmt.Sprintf(`Invalid --from month "%s", expected YYYY-MM`, from))
+		}
+	}
+	if to != "" {
+		end, err = time.Parse("2006-01", to)
+		if err != nil {
+			return start, end, WrapWithLWODError(err, fmt.Sprintf(`Invalid --to month "%s", expected YYYY-MM`, to))
+		}
+	}
+	if end.Before(start) {
+		return start, end, WrapWithLWODError(fmt.Errorf("%s is after %s", from, to), "Invalid month range")
+	}
+
+	return start, end, nil
+}
+
+// collectSheet collects the single spreadsheet given with --sheet, keyed by
+// its year and month if it's in the layout and by its ID if not.
+func collectSheet(src SheetSource, id string, config *config.Config) (map[string]LWODSheet, error) {
+	sheet, err := src.GetFile(id)
+	if err != nil {
+		return nil, err
+	}
+	if sheet.MimeType != mimeSpreadsheet {
+		return nil, WrapWithLWODError(fmt.Errorf(`"%s" is a %s`, sheet.Name, sheet.MimeType), fmt.Sprintf("File %s isn't a spreadsheet", id))
+	}
+
+	layout := newSheetLayout(config)
+	folders, err := layout.leafFolders(src, config.LWODFolder, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		for _, parent := range sheet.Parents {
+			if parent != folder.ID {
+				continue
+			}
+			if found, ok := layout.parseSheet(sheet, folder); ok {
+				return map[string]LWODSheet{
+					found.date.key(): newLWODSheet(sheet, parent, found.date),
+				}, nil
+			}
+		}
+	}
+
+	log.Debugf(`[LWOD] Spreadsheet %s ("%s") isn't in the LWOD folder layout, keying it by its ID`, sheet.ID, sheet.Name)
+	var folder string
+	if len(sheet.Parents) > 0 {
+		folder = sheet.Parents[0]
+	}
+	return map[string]LWODSheet{
+		sheet.ID: newLWODSheet(sheet, folder, sheetDate{}),
+	}, nil
+}
+
+// isMonthKey reports whether the sheet key is a year and a month (YYYY-MM).
+func isMonthKey(key string) bool {
+	_, err := time.Parse("2006-01", key)
+	return err == nil
+}
@@ -0,0 +1,183 @@
+package gsheets
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+
+	log "github.com/vyneer/lwodcollector/logger"
+	"google.golang.org/api/sheets/v4"
+)
+
+// how many rows from the top of a worksheet are searched for the header row
+const headerSearchRows = 10
+
+// the lowest score a header has to get to be matched to a template field
+const minHeaderScore = 50
+
+// defaultHeaderAliases maps the LWODTemplate fields to the headers that are
+// known to be used for them, LWOD_HEADER_ALIASES adds to these
+var defaultHeaderAliases = map[string][]string{
+	"Date":    {"date", "day", "stream date"},
+	"Start":   {"start", "start time", "starttime", "timestamp", "from"},
+	"End":     {"end", "end time", "endtime", "until"},
+	"Game":    {"game", "category"},
+	"Subject": {"subject", "subjects", "who", "people", "guest", "guests"},
+	"Topic":   {"topic", "topics", "description", "summary"},
+	"Links":   {"vod", "vods", "link", "links", "url", PlatformYouTube, PlatformTwitch, PlatformRumble, PlatformKick, PlatformOdysee},
+}
+
+// headerAliases merges the default aliases with the configured ones, matching
+// the configured field names case-insensitively.
+func headerAliases(configured map[string][]string) map[string][]string {
+	aliases := make(map[string][]string, len(defaultHeaderAliases))
+	for field, a := range defaultHeaderAliases {
+		aliases[field] = append([]string(nil), a...)
+	}
+
+	for key, a := range configured {
+		found := false
+		for field := range aliases {
+			if strings.EqualFold(key, field) {
+				aliases[field] = append(aliases[field], a...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Warnf(`[LWOD] Unknown field "%s" in the header aliases, valid: Date, Start, End, Game, Subject, Topic, Links`, key)
+		}
+	}
+
+	return aliases
+}
+
+func normalizeHeader(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// headerWords is the header in lowercase with everything but the letters
+// taken out, so "Start1" is "start" and "VOD (YT)" is "vod yt".
+func headerWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}), " ")
+}
+
+// headerScore rates how well a header matches an alias: 100 for an exact
+// match, 80 if the alias is one of the header's words, 60 if it is once the
+// numbers are left out too ("Start1") and less for headers that are a typo
+// or two away from it. Aliases that are only a part of a word ("end" in
+// "Legend") don't count.
+func headerScore(header, alias string) int {
+	header = normalizeHeader(header)
+	alias = normalizeHeader(alias)
+	if header == "" || alias == "" {
+		return 0
+	}
+
+	switch {
+	case header == alias:
+		return 100
+	case strings.Contains(" "+header+" ", " "+alias+" "):
+		return 80
+	case headerWords(alias) != "" && strings.Contains(" "+headerWords(header)+" ", " "+headerWords(alias)+" "):
+		return 60
+	}
+
+	maxDistance := 0
+	switch {
+	case len(alias) >= 7:
+		maxDistance = 2
+	case len(alias) >= 4:
+		maxDistance = 1
+	}
+	if d := levenshtein(header, alias); d <= maxDistance {
+		return 55 - d*2
+	}
+
+	return 0
+}
+
+func bestHeaderScore(header string, aliases []string) int {
+	best := 0
+	for _, a := range aliases {
+		if score := headerScore(header, a); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// findTemplate looks for the header row in the first headerSearchRows rows of
+// the worksheet, returning the template and the index of the header row. A
+// row only counts as the header if it has a date, a topic and at least one
+// link column.
+func findTemplate(rows []*sheets.RowData, aliases map[string][]string) (LWODTemplate, int, bool) {
+	for i := 0; i < len(rows) && i < headerSearchRows; i++ {
+		if rows[i] == nil {
+			continue
+		}
+		template := createTemplate(getRowValues(rows[i].Values), aliases)
+		if template.Date >= 0 && template.Topic >= 0 && len(template.Links) > 0 {
+			return template, i, true
+		}
+	}
+
+	return LWODTemplate{}, -1, false
+}
+
+// cellValue is the formatted value of the template column, or an empty string
+// for columns the template doesn't have.
+func cellValue(v []*sheets.CellData, col int) string {
+	if col < 0 || col >= len(v) {
+		return ""
+	}
+	return v[col].FormattedValue
+}
+
+func templateFields() []string {
+	var fields []string
+	tempReflectType := reflect.TypeOf(LWODTemplate{})
+	for k := 0; k < tempReflectType.NumField(); k++ {
+		if tempReflectType.Field(k).Type.Kind() == reflect.Int {
+			fields = append(fields, tempReflectType.Field(k).Name)
+		}
+	}
+	return fields
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	m := first
+	for _, v := range rest {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,28 @@
+package gsheets
+
+import "testing"
+
+func TestHeaderScore(t *testing.T) {
+	tests := []struct {
+		header, alias string
+		want          int
+	}{
+		{"End", "end", 100},
+		{"End Time", "end", 80},
+		{"VOD (YouTube)", "youtube", 80},
+		{"End1", "end", 60},
+		{"Start2", "start", 60},
+		{"Legend", "end", 0},
+		{"Recommended", "end", 0},
+		{"Fromage", "from", 0},
+		{"Endd", "end", 0},
+		{"Subjcts", "subjects", 53},
+		{"", "end", 0},
+	}
+
+	for _, tt := range tests {
+		if got := headerScore(tt.header, tt.alias); got != tt.want {
+			t.Errorf("headerScore(%q, %q) = %d, want %d", tt.header, tt.alias, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package gsheets
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/vyneer/lwodcollector/logger"
+)
+
+// the values of the timeflag column
+const (
+	timeFlagBadStart       = "unrecognized_start"
+	timeFlagBadEnd         = "unrecognized_end"
+	timeFlagEndBeforeStart = "end_before_start"
+)
+
+var segmentTimeRegex = regexp.MustCompile(`^(?:(\d+)\s*h)?\s*(?:(\d+)\s*m)?\s*(?:(\d+)\s*s)?$`)
+
+// parseSegmentTime converts a segment's start or end ("1:02:03", "62:03",
+// "1h2m", "3723") into seconds.
+func parseSegmentTime(t string) (int, bool) {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if t == "" {
+		return 0, false
+	}
+
+	if strings.Contains(t, ":") {
+		parts := strings.Split(t, ":")
+		if len(parts) > 3 {
+			return 0, false
+		}
+		seconds := 0
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 {
+				return 0, false
+			}
+			// everything but the first part has to fit into a minute/an hour
+			if i > 0 && (len(part) != 2 || n >= 60) {
+				return 0, false
+			}
+			seconds = seconds*60 + n
+		}
+		return seconds, true
+	}
+
+	if n, err := strconv.Atoi(t); err == nil && n >= 0 {
+		return n, true
+	}
+
+	matches := segmentTimeRegex.FindStringSubmatch(t)
+	if matches == nil || (matches[1] == "" && matches[2] == "" && matches[3] == "") {
+		return 0, false
+	}
+	seconds := 0
+	for i, multiplier := range []int{3600, 60, 1} {
+		if matches[i+1] != "" {
+			n, _ := strconv.Atoi(matches[i+1])
+			seconds += n * multiplier
+		}
+	}
+	return seconds, true
+}
+
+// parseSegmentTimes fills in the entry's times in seconds and its duration,
+// flagging the entry if they don't make sense.
+func (r *lwodRun) parseSegmentTimes(entry *LWODEntry, sheetID, worksheet string) {
+	segmentTimes(entry)
+	if entry.TimeFlag != "" {
+		r.flagged++
+		log.Debugf(`[LWOD] Flagged row %d of worksheet "%s" in spreadsheet %s (start "%s", end "%s"): %s`, entry.row+1, worksheet, sheetID, entry.Start, entry.End, entry.TimeFlag)
+	}
+}
+
+func segmentTimes(entry *LWODEntry) {
+	var flags []string
+
+	if start, ok := parseSegmentTime(entry.Start); ok {
+		entry.StartSeconds = sql.NullInt64{Int64: int64(start), Valid: true}
+	} else if strings.TrimSpace(entry.Start) != "" {
+		flags = append(flags, timeFlagBadStart)
+	}
+	if end, ok := parseSegmentTime(entry.End); ok {
+		entry.EndSeconds = sql.NullInt64{Int64: int64(end), Valid: true}
+	} else if strings.TrimSpace(entry.End) != "" {
+		flags = append(flags, timeFlagBadEnd)
+	}
+
+	if entry.StartSeconds.Valid && entry.EndSeconds.Valid {
+		if entry.EndSeconds.Int64 < entry.StartSeconds.Int64 {
+			flags = append(flags, timeFlagEndBeforeStart)
+		} else {
+			entry.Duration = sql.NullInt64{Int64: entry.EndSeconds.Int64 - entry.StartSeconds.Int64, Valid: true}
+		}
+	}
+
+	entry.TimeFlag = strings.Join(flags, ",")
+}
+
+// backfillSegmentTimes parses the times of the rows that were added before
+// the times in seconds were stored.
+func (r *lwodRun) backfillSegmentTimes() error {
+	db := r.config.LWODDBConfig.DB
+	rows, err := db.Query("SELECT id, starttime, endtime FROM lwod WHERE startseconds IS NULL AND endseconds IS NULL AND timeflag IS NULL AND (starttime != '' OR endtime != '')")
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't get the rows without times in seconds")
+	}
+	var entries []LWODEntry
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var entry LWODEntry
+		if err := rows.Scan(&id, &entry.Start, &entry.End); err != nil {
+			rows.Close()
+			return WrapWithLWODError(err, "Couldn't get the rows without times in seconds")
+		}
+		ids = append(ids, id)
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return WrapWithLWODError(err, "Couldn't get the rows without times in seconds")
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	log.Infof("[LWOD] Parsing the start/end times of %d existing row(s)", len(entries))
+	tx, err := db.Begin()
+	if err != nil {
+		return WrapWithLWODError(err, "Couldn't begin the Tx")
+	}
+	for i := range entries {
+		entry := &entries[i]
+		segmentTimes(entry)
+		_, err := tx.Exec("UPDATE lwod SET startseconds = ?, endseconds = ?, duration = ?, timeflag = ? WHERE id = ?", entry.StartSeconds, entry.EndSeconds, entry.Duration, newNullString(entry.TimeFlag), ids[i])
+		if err != nil {
+			tx.Rollback()
+			return WrapWithLWODError(err, fmt.Sprintf("Couldn't update the times of entry %d", ids[i]))
+		}
+	}
+
+	return tx.Commit()
+}
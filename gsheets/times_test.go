@@ -0,0 +1,121 @@
+package gsheets
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestParseSegmentTime(t *testing.T) {
+	tests := []struct {
+		t    string
+		want int
+		ok   bool
+	}{
+		{"1:02:03", 3723, true},
+		{"01:02:03", 3723, true},
+		{"62:03", 3723, true},
+		{"0:00", 0, true},
+		{" 0:05 ", 5, true},
+		{"100:00:00", 360000, true},
+		{"3723", 3723, true},
+		{"0", 0, true},
+		{"1h2m3s", 3723, true},
+		{"1h2m", 3720, true},
+		{"1h 2m 3s", 3723, true},
+		{"1 h 2 m", 3720, true},
+		{"90s", 90, true},
+		{"2m", 120, true},
+		{"1H", 3600, true},
+		{"2m30s", 150, true},
+
+		{"", 0, false},
+		{"   ", 0, false},
+		{"1:2", 0, false},
+		{"1:02:3", 0, false},
+		{"1:60", 0, false},
+		{"1:60:00", 0, false},
+		{"1:02:03:04", 0, false},
+		{":30", 0, false},
+		{"1:", 0, false},
+		{"-5", 0, false},
+		{"1:-1", 0, false},
+		{"1.5", 0, false},
+		{"1h2", 0, false},
+		{"2s1m", 0, false},
+		{"h", 0, false},
+		{"1:02 PM", 0, false},
+		{"end", 0, false},
+		{"?", 0, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := parseSegmentTime(tt.t); got != tt.want || ok != tt.ok {
+			t.Errorf("parseSegmentTime(%q) = %d, %v, want %d, %v", tt.t, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBackfillSegmentTimes(t *testing.T) {
+	cfg := testConfig(t)
+	db := cfg.LWODDBConfig.DB
+
+	rows := []struct {
+		start, end string
+		// what's already stored, the rows with times in seconds or a flag
+		// are left alone
+		startSeconds sql.NullInt64
+		flag         sql.NullString
+
+		wantStart, wantEnd, wantDuration sql.NullInt64
+		wantFlag                         sql.NullString
+	}{
+		{
+			start: "0:00", end: "1:02:03",
+			wantStart: sql.NullInt64{Int64: 0, Valid: true}, wantEnd: sql.NullInt64{Int64: 3723, Valid: true}, wantDuration: sql.NullInt64{Int64: 3723, Valid: true},
+		},
+		{
+			start: "1h", end: "",
+			wantStart: sql.NullInt64{Int64: 3600, Valid: true},
+		},
+		{
+			start: "soon", end: "later",
+			wantFlag: sql.NullString{String: timeFlagBadStart + "," + timeFlagBadEnd, Valid: true},
+		},
+		{
+			start: "2:00", end: "1:00",
+			wantStart: sql.NullInt64{Int64: 120, Valid: true}, wantEnd: sql.NullInt64{Int64: 60, Valid: true},
+			wantFlag: sql.NullString{String: timeFlagEndBeforeStart, Valid: true},
+		},
+		{
+			start: "0:10", end: "0:20", startSeconds: sql.NullInt64{Int64: 5, Valid: true},
+			wantStart: sql.NullInt64{Int64: 5, Valid: true},
+		},
+		{
+			start: "0:10", end: "0:20", flag: sql.NullString{String: "checked", Valid: true},
+			wantFlag: sql.NullString{String: "checked", Valid: true},
+		},
+	}
+
+	for _, row := range rows {
+		_, err := db.Exec("INSERT INTO lwod (starttime, endtime, startseconds, timeflag) VALUES (?, ?, ?, ?)", row.start, row.end, row.startSeconds, row.flag)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := newLWODRun(cfg).backfillSegmentTimes(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, row := range rows {
+		var start, end, duration sql.NullInt64
+		var flag sql.NullString
+		err := db.QueryRow("SELECT startseconds, endseconds, duration, timeflag FROM lwod WHERE id = ?", i+1).Scan(&start, &end, &duration, &flag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start != row.wantStart || end != row.wantEnd || duration != row.wantDuration || flag != row.wantFlag {
+			t.Errorf("%q-%q: got %v, %v, %v, %v, want %v, %v, %v, %v", row.start, row.end, start, end, duration, flag, row.wantStart, row.wantEnd, row.wantDuration, row.wantFlag)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,9 +20,12 @@ import (
 )
 
 var cfg config.Config
+var flags config.Flags
 var defFlags *flag.FlagSet
 var sheetsFlags *flag.FlagSet
 var ytFlags *flag.FlagSet
+var searchFlags *flag.FlagSet
+var historyFlags *flag.FlagSet
 
 func init() {
 	log.SetHandler(text.New((os.Stderr)))
@@ -32,21 +37,43 @@ func init() {
 	time.Local = loc
 
 	defFlags = flag.NewFlagSet("for all subcommands", flag.ExitOnError)
-	defFlags.BoolVarP(&cfg.Flags.Verbose, "verbose", "v", false, "Show debug messages")
+	defFlags.BoolVarP(&flags.Verbose, "verbose", "v", false, "Show debug messages")
 
 	sheetsFlags = flag.NewFlagSet("LWOD", flag.ExitOnError)
-	sheetsFlags.BoolVarP(&cfg.Flags.AllSheets, "all", "a", false, "Process every single sheet")
+	sheetsFlags.BoolVarP(&flags.AllSheets, "all", "a", false, "Process every single sheet")
+	sheetsFlags.BoolVarP(&flags.Lenient, "lenient", "l", false, "Record malformed rows in the parse_errors table and skip them instead of stopping")
+	sheetsFlags.BoolVar(&flags.DryRun, "dry-run", false, "Print what would change for every VOD without writing anything to the DB")
+	sheetsFlags.BoolVarP(&flags.Force, "force", "f", false, "Parse the spreadsheets even if they haven't changed since they were last parsed")
+	sheetsFlags.StringVar(&flags.From, "from", "", "Process the sheets starting with this month (YYYY-MM)")
+	sheetsFlags.StringVar(&flags.To, "to", "", "Process the sheets up to and including this month (YYYY-MM)")
+	sheetsFlags.StringVar(&flags.Sheet, "sheet", "", "Process only the spreadsheet with this ID")
+	sheetsFlags.StringVar(&flags.Snapshots, "snapshots", "", "The snapshot store to replay (replay only)")
+	sheetsFlags.StringVar(&flags.DB, "db", "", "The new LWOD DB to replay the snapshots into (replay only)")
 	sheetsFlags.AddFlagSet(defFlags)
 
 	ytFlags = flag.NewFlagSet("YT", flag.ExitOnError)
-	ytFlags.BoolVarP(&cfg.Flags.AllVideos, "all", "a", false, "Process every single video")
+	ytFlags.BoolVarP(&flags.AllVideos, "all", "a", false, "Process every single video")
 	ytFlags.AddFlagSet(defFlags)
+
+	searchFlags = flag.NewFlagSet("search", flag.ExitOnError)
+	searchFlags.IntVarP(&flags.Limit, "limit", "n", 20, "How many results to print")
+	searchFlags.AddFlagSet(defFlags)
+
+	historyFlags = flag.NewFlagSet("history", flag.ExitOnError)
+	historyFlags.StringVar(&flags.VOD, "vod", "", "The ID of the VOD to print the history of")
+	historyFlags.AddFlagSet(defFlags)
 }
 
-func main() {
-	cfg = config.Initialize()
+func initialize(offline bool) {
+	if offline {
+		cfg = config.InitializeOffline(flags)
+	} else {
+		cfg = config.Initialize(flags)
+	}
 	cfg.Continuous = false
+}
 
+func main() {
 	if len(os.Args) == 1 {
 		log.Fatalf("No subcommand given")
 	}
@@ -54,9 +81,10 @@ func main() {
 	switch os.Args[1] {
 	case "continuous":
 		defFlags.Parse(os.Args[2:])
-		if cfg.Flags.Verbose {
+		if flags.Verbose {
 			log.SetLevel(apex.DebugLevel)
 		}
+		initialize(false)
 
 		cfg.Continuous = true
 		cfg.Flags.AllSheets = false
@@ -94,9 +122,10 @@ func main() {
 		wg.Wait()
 	case "youtube":
 		ytFlags.Parse(os.Args[2:])
-		if cfg.Flags.Verbose {
+		if flags.Verbose {
 			log.SetLevel(apex.DebugLevel)
 		}
+		initialize(false)
 
 		api := make(chan []*youtube.Video)
 		scraped := make(chan []*youtube.Video)
@@ -120,17 +149,109 @@ func main() {
 		}
 	case "lwod":
 		sheetsFlags.Parse(os.Args[2:])
-		if cfg.Flags.Verbose {
+		if flags.Verbose {
+			log.SetLevel(apex.DebugLevel)
+		}
+
+		switch sheetsFlags.Arg(0) {
+		case "":
+			targets := 0
+			for _, set := range []bool{flags.AllSheets, flags.From != "" || flags.To != "", flags.Sheet != ""} {
+				if set {
+					targets++
+				}
+			}
+			if targets > 1 {
+				log.Errorf("[LWOD] --all, --from/--to and --sheet can't be used together")
+				os.Exit(2)
+			}
+			initialize(false)
+			err := gsheets.SheetsLoop(&cfg)
+			if err != nil {
+				log.Errorf("[LWOD] Got an error, shutting down: %v", err)
+				os.Exit(2)
+			}
+		case "import":
+			if sheetsFlags.NArg() < 2 {
+				log.Errorf("[LWOD] No path given, usage: lwod import <path>")
+				os.Exit(2)
+			}
+			initialize(true)
+			err := gsheets.ImportSheets(sheetsFlags.Arg(1), &cfg)
+			if err != nil {
+				log.Errorf("[LWOD] Got an error, shutting down: %v", err)
+				os.Exit(2)
+			}
+		case "games":
+			initialize(true)
+			err := gsheets.ListUnresolvedGames(&cfg)
+			if err != nil {
+				log.Errorf("[LWOD] Got an error, shutting down: %v", err)
+				os.Exit(2)
+			}
+		case "replay":
+			if flags.Snapshots == "" || flags.DB == "" {
+				log.Errorf("[LWOD] No snapshots or DB given, usage: lwod replay --snapshots <dir> --db <out.db>")
+				os.Exit(2)
+			}
+			if _, err := os.Stat(filepath.Join(flags.Snapshots, "snapshots.db")); err != nil {
+				log.Errorf("[LWOD] %s isn't a snapshot store: %v", flags.Snapshots, err)
+				os.Exit(2)
+			}
+			if _, err := os.Stat(flags.DB); err == nil {
+				log.Errorf("[LWOD] %s already exists, the snapshots have to be replayed into a new DB", flags.DB)
+				os.Exit(2)
+			}
+
+			// replays only need the LWOD settings, and the flags are needed to
+			// open the DBs
+			cfg = config.LoadLWODDotEnv()
+			cfg.Flags = flags
+			cfg.LWODSnapshotDir = flags.Snapshots
+			config.LoadLWODDatabase(&cfg)
+			err := gsheets.ReplaySnapshots(&cfg)
+			if err != nil {
+				log.Errorf("[LWOD] Got an error, shutting down: %v", err)
+				os.Exit(2)
+			}
+		default:
+			log.Errorf("%q is not a valid lwod mode, valid:\n- import\n- games\n- replay", sheetsFlags.Arg(0))
+			os.Exit(2)
+		}
+	case "search":
+		searchFlags.Parse(os.Args[2:])
+		if flags.Verbose {
 			log.SetLevel(apex.DebugLevel)
 		}
+		if searchFlags.NArg() < 1 {
+			log.Errorf("[LWOD] No query given, usage: search <query>")
+			os.Exit(2)
+		}
+
+		initialize(true)
+		err := gsheets.PrintSearch(&cfg, strings.Join(searchFlags.Args(), " "), flags.Limit)
+		if err != nil {
+			log.Errorf("[LWOD] Got an error, shutting down: %v", err)
+			os.Exit(2)
+		}
+	case "history":
+		historyFlags.Parse(os.Args[2:])
+		if flags.Verbose {
+			log.SetLevel(apex.DebugLevel)
+		}
+		if flags.VOD == "" {
+			log.Errorf("[LWOD] No VOD given, usage: history --vod <id>")
+			os.Exit(2)
+		}
 
-		err := gsheets.SheetsLoop(&cfg)
+		initialize(true)
+		err := gsheets.PrintHistory(&cfg, flags.VOD)
 		if err != nil {
 			log.Errorf("[LWOD] Got an error, shutting down: %v", err)
 			os.Exit(2)
 		}
 	default:
-		log.Errorf("%q is not a valid subcommand, valid:\n- lwod\n- youtube\n- continuous", os.Args[1])
+		log.Errorf("%q is not a valid subcommand, valid:\n- lwod\n- youtube\n- continuous\n- search\n- history", os.Args[1])
 		os.Exit(2)
 	}
 }
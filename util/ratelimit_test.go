@@ -0,0 +1,71 @@
+package util
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		if l := NewRateLimiter(rate); l != nil {
+			t.Errorf("NewRateLimiter(%v) = %+v, want nil", rate, l)
+		}
+	}
+
+	tests := []struct {
+		rate, burst float64
+	}{
+		{0.5, 1},
+		{1, 1},
+		{2.5, 3},
+		{10, 10},
+	}
+	for _, tt := range tests {
+		l := NewRateLimiter(tt.rate)
+		if l == nil || l.burst != tt.burst || l.tokens != tt.burst {
+			t.Errorf("NewRateLimiter(%v) = %+v, want a burst of %v", tt.rate, l, tt.burst)
+		}
+	}
+}
+
+func TestRateLimiterNil(t *testing.T) {
+	var l *RateLimiter
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		l.Wait()
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("a nil RateLimiter took %v for 1000 requests", elapsed)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(100)
+
+	// the burst goes through right away
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		l.Wait()
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("the burst of 100 requests took %v", elapsed)
+	}
+
+	// after that it's 10ms a request, shared by everyone waiting
+	start = time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				l.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("20 requests after the burst took %v, want about 200ms", elapsed)
+	}
+}